@@ -0,0 +1,233 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/middleware"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const KontrolAuditSinksEnvKey = "TEAMS_KONTROL_AUDIT_SINKS"
+const KontrolAuditFileEnvKey = "TEAMS_KONTROL_AUDIT_FILE"
+const KontrolAuditFileMaxSizeEnvKey = "TEAMS_KONTROL_AUDIT_FILE_MAX_SIZE"
+const KontrolAuditFileMaxBackupsEnvKey = "TEAMS_KONTROL_AUDIT_FILE_MAX_BACKUPS"
+const KontrolAuditWebhookEnvKey = "TEAMS_KONTROL_AUDIT_WEBHOOK"
+
+// types of audit events
+const (
+	CommandEvent   = "command"
+	ElevationEvent = "elevation"
+)
+
+// authorization decisions recorded for commands
+const (
+	DecisionAllowed              = "allowed"
+	DecisionDenied               = "denied"
+	DecisionConfirmationRequired = "confirmation_required"
+	DecisionConfirmed            = "confirmed"
+	DecisionCancelled            = "cancelled"
+	DecisionApprovalRequired     = "approval_required"
+	DecisionApproved             = "approved"
+	DecisionRejected             = "rejected"
+	DecisionGranted              = "granted"
+	DecisionRevoked              = "revoked"
+)
+
+// results recorded for commands
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultPending = "pending"
+)
+
+// Event is a structured record of a request to teams-kontrol and what was done with it
+type Event struct {
+	Time        time.Time   `json:"time"`
+	Type        string      `json:"type"`
+	RequestID   string      `json:"requestId,omitempty"`
+	MSRequestID string      `json:"msRequestId,omitempty"`
+	RemoteAddr  string      `json:"remoteAddr,omitempty"`
+	User        string      `json:"user,omitempty"`
+	AADObjectID string      `json:"aadObjectId,omitempty"`
+	TeamID      string      `json:"teamId,omitempty"`
+	ChannelID   string      `json:"channelId,omitempty"`
+	RawText     string      `json:"rawText,omitempty"` // the message exactly as it was sent
+	Text        string      `json:"text,omitempty"`    // the text the command was parsed from
+	Command     interface{} `json:"command,omitempty"`
+	ID          string      `json:"id,omitempty"` // ID of the pending command, approval request or elevation
+	Approver    string      `json:"approver,omitempty"`
+	Decision    string      `json:"decision,omitempty"`
+	Reason      string      `json:"reason,omitempty"`
+	Result      string      `json:"result,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	DurationMS  int64       `json:"durationMs"`
+
+	start time.Time
+}
+
+// Sink writes audit events to a destination. i.e. stdout, a file or a webhook
+type Sink interface {
+	Write(event *Event) error
+}
+
+var auditEvents = expvar.NewMap("audit_events")
+
+var sinks = struct {
+	sync.RWMutex
+	sinks []Sink
+}{sinks: []Sink{newWriterSink(os.Stdout)}}
+
+type contextKey struct{}
+
+// Init creates the sinks listed in TEAMS_KONTROL_AUDIT_SINKS, which defaults to stdout
+func Init() error {
+	names := os.Getenv(KontrolAuditSinksEnvKey)
+	if names == "" {
+		names = "stdout"
+	}
+
+	var configured []Sink
+	for _, name := range strings.Split(names, ",") {
+		sink, err := newSink(strings.ToLower(strings.TrimSpace(name)))
+		if err != nil {
+			return err
+		}
+		configured = append(configured, sink)
+	}
+	SetSinks(configured...)
+	logrus.Infof("writing audit events to: %s", names)
+	return nil
+}
+
+// newSink creates the sink with the given name from its environment variables
+func newSink(name string) (Sink, error) {
+	switch name {
+	case "stdout":
+		return newWriterSink(os.Stdout), nil
+	case "file":
+		path := os.Getenv(KontrolAuditFileEnvKey)
+		if path == "" {
+			return nil, errors.New(fmt.Sprintf("%s must be set to write audit events to a file", KontrolAuditFileEnvKey))
+		}
+		maxSize, err := intFromEnv(KontrolAuditFileMaxSizeEnvKey, 100)
+		if err != nil {
+			return nil, err
+		}
+		maxBackups, err := intFromEnv(KontrolAuditFileMaxBackupsEnvKey, 5)
+		if err != nil {
+			return nil, err
+		}
+		return NewFileSink(path, int64(maxSize)*1024*1024, maxBackups)
+	case "webhook":
+		url := os.Getenv(KontrolAuditWebhookEnvKey)
+		if url == "" {
+			return nil, errors.New(fmt.Sprintf("%s must be set to send audit events to a webhook", KontrolAuditWebhookEnvKey))
+		}
+		return NewWebhookSink(url), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown audit sink %s, expected stdout, file or webhook", name))
+	}
+}
+
+// intFromEnv returns the value of the environment variable as an int or the default when it isn't set
+func intFromEnv(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i <= 0 {
+		return 0, errors.New(fmt.Sprintf("invalid %s '%s', expected a positive number", key, value))
+	}
+	return i, nil
+}
+
+// SetSinks replaces the sinks that audit events are written to
+func SetSinks(s ...Sink) {
+	sinks.Lock()
+	sinks.sinks = s
+	sinks.Unlock()
+}
+
+// NewEvent starts an event of the given type for the request, which is timed until it's recorded
+func NewEvent(ctx context.Context, eventType string) *Event {
+	event := &Event{Type: eventType, start: time.Now()}
+	event.RequestID = contextString(ctx, middleware.ContextRequestID)
+	event.MSRequestID = contextString(ctx, middleware.ContextMSRequestID)
+	event.RemoteAddr = contextString(ctx, middleware.ContextRemoteAddr)
+	return event
+}
+
+func contextString(ctx context.Context, key middleware.ContextKey) string {
+	value, _ := ctx.Value(key).(string)
+	return value
+}
+
+// NewContext returns a copy of the context carrying the event so that handlers can add to it
+func NewContext(ctx context.Context, event *Event) context.Context {
+	return context.WithValue(ctx, contextKey{}, event)
+}
+
+// FromContext returns the event carried by the context.
+// An event that is never recorded is returned when there isn't one so that callers don't need to check.
+func FromContext(ctx context.Context) *Event {
+	if event, ok := ctx.Value(contextKey{}).(*Event); ok {
+		return event
+	}
+	return &Event{}
+}
+
+// Decide records the authorization decision and the reason for it
+func (e *Event) Decide(decision string, reason error) {
+	e.Decision = decision
+	if reason != nil {
+		e.Reason = reason.Error()
+	}
+}
+
+// Fail records that the request failed with the error
+func (e *Event) Fail(err error) {
+	e.Result = ResultFailure
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// Record writes the event to every sink. Failing to write to a sink is logged rather than failing the request.
+func Record(event *Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if !event.start.IsZero() {
+		event.DurationMS = time.Since(event.start).Milliseconds()
+	}
+	if event.Result == "" {
+		switch event.Decision {
+		case DecisionDenied, DecisionCancelled, DecisionRejected:
+			event.Result = ResultFailure
+		case DecisionConfirmationRequired, DecisionApprovalRequired:
+			event.Result = ResultPending
+		default:
+			event.Result = ResultSuccess
+		}
+	}
+
+	sinks.RLock()
+	defer sinks.RUnlock()
+	for _, sink := range sinks.sinks {
+		err := sink.Write(event)
+		if err != nil {
+			auditEvents.Add("failed", 1)
+			logrus.Errorf("failed to write audit event: %v", err)
+			continue
+		}
+		auditEvents.Add("written", 1)
+	}
+}
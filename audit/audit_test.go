@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/middleware"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	var out bytes.Buffer
+	SetSinks(newWriterSink(&out))
+	defer SetSinks(newWriterSink(os.Stdout))
+
+	ctx := context.WithValue(context.Background(), middleware.ContextRequestID, "abc-123")
+	event := NewEvent(ctx, CommandEvent)
+	event.User = "Daniel Cole"
+	event.Text = "delete pods default nginx"
+	event.Decide(DecisionDenied, errors.New("no rule allows delete pods/nginx in namespace default"))
+	Record(event)
+
+	var recorded Event
+	err := json.Unmarshal(out.Bytes(), &recorded)
+	if err != nil {
+		t.Fatalf("failed to unmarshal audit event %s: %v", out.String(), err)
+	}
+	if recorded.RequestID != "abc-123" || recorded.User != "Daniel Cole" || recorded.Text != "delete pods default nginx" {
+		t.Errorf("expected request ID, user and text to be recorded, got %+v", recorded)
+	}
+	if recorded.Decision != DecisionDenied || recorded.Result != ResultFailure || recorded.Reason == "" {
+		t.Errorf("expected denied decision with a reason and failed result, got %+v", recorded)
+	}
+	if recorded.Time.IsZero() {
+		t.Error("expected time to be recorded")
+	}
+}
+
+func TestFromContextWithoutEvent(t *testing.T) {
+	event := FromContext(context.Background())
+	event.Decide(DecisionAllowed, nil) // must not panic
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	sink, err := NewFileSink(path, 200, 2)
+	if err != nil {
+		t.Fatalf("failed to create file sink: %v", err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 10; i++ {
+		err = sink.Write(&Event{Type: CommandEvent, Text: fmt.Sprintf("get pods default %d", i)})
+		if err != nil {
+			t.Fatalf("failed to write event: %v", err)
+		}
+	}
+
+	for _, name := range []string{"audit.log", "audit.log.1", "audit.log.2"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("expected %s to be rotated before exceeding the max size, got %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit.log.3")); !os.IsNotExist(err) {
+		t.Error("expected only 2 backups to be kept")
+	}
+
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit file: %v", err)
+	}
+	if !strings.Contains(string(current), "get pods default 9") {
+		t.Errorf("expected the latest event in the current file, got %s", current)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		err := json.NewDecoder(r.Body).Decode(&event)
+		if err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL)
+	err := sink.Write(&Event{Type: ElevationEvent, User: "Daniel Cole", Decision: DecisionGranted})
+	if err != nil {
+		t.Fatalf("failed to write event: %v", err)
+	}
+
+	select {
+	case event := <-received:
+		if event.User != "Daniel Cole" || event.Decision != DecisionGranted {
+			t.Errorf("unexpected event sent to webhook: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event to be sent to webhook")
+	}
+}
+
+func TestInitUnknownSink(t *testing.T) {
+	_ = os.Setenv(KontrolAuditSinksEnvKey, "stdout,syslog")
+	defer os.Unsetenv(KontrolAuditSinksEnvKey)
+
+	err := Init()
+	if err == nil {
+		t.Error("expected an unknown sink to be rejected")
+	}
+}
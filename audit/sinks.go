@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// writerSink writes each event as a line of json
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newWriterSink(w io.Writer) *writerSink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// FileSink writes each event as a line of json to a file which is rotated once it reaches the max size.
+// Rotated files are renamed with a numbered suffix, i.e. audit.log.1, and only the most recent max backups are kept.
+type FileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink opens the file for appending, creating it if it doesn't exist
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to open audit file %s: %v", s.path, err))
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return errors.New(fmt.Sprintf("failed to stat audit file %s: %v", s.path, err))
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		err = s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the existing backups up by one, dropping the oldest, and starts a new file
+func (s *FileSink) rotate() error {
+	err := s.file.Close()
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to close audit file %s: %v", s.path, err))
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if s.maxBackups > 0 {
+		err = os.Rename(s.path, s.path+".1")
+	} else {
+		err = os.Remove(s.path)
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to rotate audit file %s: %v", s.path, err))
+	}
+	return s.open()
+}
+
+// Close closes the current file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// WebhookSink posts each event as json to a url.
+// Events are queued and sent in the background so that a slow webhook doesn't delay the reply to teams,
+// events are dropped when the queue is full.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan []byte
+}
+
+const webhookQueueSize = 1000
+
+// NewWebhookSink starts sending events to the url
+func NewWebhookSink(url string) *WebhookSink {
+	s := &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan []byte, webhookQueueSize),
+	}
+	go s.run()
+	return s
+}
+
+func (s *WebhookSink) Write(event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	select {
+	case s.queue <- body:
+		return nil
+	default:
+		auditEvents.Add("dropped", 1)
+		return errors.New("audit webhook queue is full, dropping event")
+	}
+}
+
+func (s *WebhookSink) run() {
+	for body := range s.queue {
+		err := s.post(body)
+		if err != nil {
+			auditEvents.Add("failed", 1)
+			logrus.Errorf("failed to send audit event to webhook: %v", err)
+		}
+	}
+}
+
+func (s *WebhookSink) post(body []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("webhook responded with %s", resp.Status))
+	}
+	return nil
+}
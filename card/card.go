@@ -0,0 +1,257 @@
+package card
+
+import "encoding/json"
+
+const schema = "http://adaptivecards.io/schemas/adaptive-card.json"
+const version = "1.5"
+
+// Element is implemented by everything that can be placed in the body of a card or a container
+type Element interface {
+	element()
+}
+
+// Action is implemented by everything that can be placed in the actions of a card or an ActionSet
+type Action interface {
+	action()
+}
+
+// Card is the root of an adaptive card
+// See: https://adaptivecards.io/explorer/AdaptiveCard.html
+type Card struct {
+	Body    []Element `json:"body"`
+	Actions []Action  `json:"actions,omitempty"`
+	MSTeams *MSTeams  `json:"msteams,omitempty"`
+}
+
+// MSTeams holds teams specific card properties
+type MSTeams struct {
+	Width string `json:"width,omitempty"`
+}
+
+// New returns a card containing the given elements
+func New(body ...Element) *Card {
+	return &Card{
+		Body: body,
+	}
+}
+
+func (c Card) MarshalJSON() ([]byte, error) {
+	type alias Card
+	return json.Marshal(struct {
+		Schema  string `json:"$schema"`
+		Type    string `json:"type"`
+		Version string `json:"version"`
+		alias
+	}{schema, "AdaptiveCard", version, alias(c)})
+}
+
+// TextBlock displays text
+// See: https://adaptivecards.io/explorer/TextBlock.html
+type TextBlock struct {
+	Text                string `json:"text"`
+	Wrap                bool   `json:"wrap,omitempty"`
+	Size                string `json:"size,omitempty"`
+	Weight              string `json:"weight,omitempty"`
+	Color               string `json:"color,omitempty"`
+	FontType            string `json:"fontType,omitempty"`
+	IsSubtle            bool   `json:"isSubtle,omitempty"`
+	HorizontalAlignment string `json:"horizontalAlignment,omitempty"`
+	Separator           bool   `json:"separator,omitempty"`
+}
+
+func (TextBlock) element() {}
+
+func (t TextBlock) MarshalJSON() ([]byte, error) {
+	type alias TextBlock
+	return marshalWithType("TextBlock", alias(t))
+}
+
+// Title returns a TextBlock styled as the heading of a card
+func Title(text string) TextBlock {
+	return TextBlock{
+		Text:                text,
+		Wrap:                true,
+		Size:                "Large",
+		Weight:              "Bolder",
+		Color:               "Accent",
+		HorizontalAlignment: "Center",
+	}
+}
+
+// Fact is a single title/value pair in a FactSet
+type Fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// FactSet displays a series of facts in a tabular form
+// See: https://adaptivecards.io/explorer/FactSet.html
+type FactSet struct {
+	Facts []Fact `json:"facts"`
+}
+
+func (FactSet) element() {}
+
+func (f FactSet) MarshalJSON() ([]byte, error) {
+	type alias FactSet
+	return marshalWithType("FactSet", alias(f))
+}
+
+// Container groups elements together
+// See: https://adaptivecards.io/explorer/Container.html
+type Container struct {
+	Items     []Element `json:"items"`
+	Style     string    `json:"style,omitempty"`
+	Separator bool      `json:"separator,omitempty"`
+}
+
+func (Container) element() {}
+
+func (c Container) MarshalJSON() ([]byte, error) {
+	type alias Container
+	return marshalWithType("Container", alias(c))
+}
+
+// Column is a single column in a ColumnSet
+// See: https://adaptivecards.io/explorer/Column.html
+type Column struct {
+	Items []Element `json:"items"`
+	Width string    `json:"width,omitempty"`
+}
+
+func (c Column) MarshalJSON() ([]byte, error) {
+	type alias Column
+	return marshalWithType("Column", alias(c))
+}
+
+// ColumnSet divides a region into columns
+// See: https://adaptivecards.io/explorer/ColumnSet.html
+type ColumnSet struct {
+	Columns []Column `json:"columns"`
+}
+
+func (ColumnSet) element() {}
+
+func (c ColumnSet) MarshalJSON() ([]byte, error) {
+	type alias ColumnSet
+	return marshalWithType("ColumnSet", alias(c))
+}
+
+// TableColumnDefinition defines the width of a column in a Table
+type TableColumnDefinition struct {
+	Width int `json:"width"`
+}
+
+// TableCell is a single cell in a TableRow
+type TableCell struct {
+	Items []Element `json:"items"`
+}
+
+func (t TableCell) MarshalJSON() ([]byte, error) {
+	type alias TableCell
+	return marshalWithType("TableCell", alias(t))
+}
+
+// TableRow is a single row in a Table
+type TableRow struct {
+	Cells []TableCell `json:"cells"`
+}
+
+func (t TableRow) MarshalJSON() ([]byte, error) {
+	type alias TableRow
+	return marshalWithType("TableRow", alias(t))
+}
+
+// Table displays data in a tabular form
+// See: https://adaptivecards.io/explorer/Table.html
+type Table struct {
+	Columns           []TableColumnDefinition `json:"columns"`
+	Rows              []TableRow              `json:"rows"`
+	FirstRowAsHeaders bool                    `json:"firstRowAsHeaders"`
+	ShowGridLines     bool                    `json:"showGridLines"`
+}
+
+func (Table) element() {}
+
+func (t Table) MarshalJSON() ([]byte, error) {
+	type alias Table
+	return marshalWithType("Table", alias(t))
+}
+
+// NewTable returns a table with the given header row followed by a row for each of the given rows
+// each cell is rendered as a wrapped TextBlock
+func NewTable(headers []string, rows [][]string) Table {
+	table := Table{
+		FirstRowAsHeaders: true,
+		ShowGridLines:     true,
+	}
+	for range headers {
+		table.Columns = append(table.Columns, TableColumnDefinition{Width: 1})
+	}
+	table.Rows = append(table.Rows, textRow(headers, "Bolder"))
+	for _, row := range rows {
+		table.Rows = append(table.Rows, textRow(row, ""))
+	}
+	return table
+}
+
+func textRow(values []string, weight string) TableRow {
+	row := TableRow{}
+	for _, value := range values {
+		row.Cells = append(row.Cells, TableCell{
+			Items: []Element{TextBlock{Text: value, Wrap: true, Weight: weight}},
+		})
+	}
+	return row
+}
+
+// ActionSet displays a set of actions within the body of a card
+// See: https://adaptivecards.io/explorer/ActionSet.html
+type ActionSet struct {
+	Actions []Action `json:"actions"`
+}
+
+func (ActionSet) element() {}
+
+func (a ActionSet) MarshalJSON() ([]byte, error) {
+	type alias ActionSet
+	return marshalWithType("ActionSet", alias(a))
+}
+
+// Submit gathers the data and sends it back to the bot when clicked
+// See: https://adaptivecards.io/explorer/Action.Submit.html
+type Submit struct {
+	Title string      `json:"title"`
+	Style string      `json:"style,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+func (Submit) action() {}
+
+func (s Submit) MarshalJSON() ([]byte, error) {
+	type alias Submit
+	return marshalWithType("Action.Submit", alias(s))
+}
+
+// marshalWithType marshals the given value with the adaptive card type property set
+// value is expected to be an alias of the element so that MarshalJSON isn't called recursively
+func marshalWithType(elementType string, value interface{}) ([]byte, error) {
+	properties, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	typeProperty, err := json.Marshal(elementType)
+	if err != nil {
+		return nil, err
+	}
+
+	// splice the type property in at the start of the marshalled object
+	out := make([]byte, 0, len(properties)+len(typeProperty)+9)
+	out = append(out, `{"type":`...)
+	out = append(out, typeProperty...)
+	if len(properties) > 2 { // more than just {}
+		out = append(out, ',')
+	}
+	out = append(out, properties[1:]...)
+	return out, nil
+}
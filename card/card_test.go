@@ -0,0 +1,32 @@
+package card
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalElementTypes(t *testing.T) {
+	c := New(
+		TextBlock{Text: "hello"},
+		ColumnSet{Columns: []Column{{Items: []Element{FactSet{}}}}},
+		NewTable([]string{"Name"}, [][]string{{"nginx"}}),
+		ActionSet{Actions: []Action{Submit{Title: "Confirm", Data: map[string]string{"id": "1"}}}},
+	)
+
+	out, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("failed to marshal card: %v", err)
+	}
+
+	expected := `{"$schema":"http://adaptivecards.io/schemas/adaptive-card.json","type":"AdaptiveCard","version":"1.5","body":[` +
+		`{"type":"TextBlock","text":"hello"},` +
+		`{"type":"ColumnSet","columns":[{"type":"Column","items":[{"type":"FactSet","facts":null}]}]},` +
+		`{"type":"Table","columns":[{"width":1}],"rows":[` +
+		`{"type":"TableRow","cells":[{"type":"TableCell","items":[{"type":"TextBlock","text":"Name","wrap":true,"weight":"Bolder"}]}]},` +
+		`{"type":"TableRow","cells":[{"type":"TableCell","items":[{"type":"TextBlock","text":"nginx","wrap":true}]}]}],` +
+		`"firstRowAsHeaders":true,"showGridLines":true},` +
+		`{"type":"ActionSet","actions":[{"type":"Action.Submit","title":"Confirm","data":{"id":"1"}}]}]}`
+	if string(out) != expected {
+		t.Fatalf("unexpected card json\ngot:      %s\nexpected: %s", out, expected)
+	}
+}
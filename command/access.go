@@ -0,0 +1,107 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// AccessDeniedError is returned when kubernetes RBAC wouldn't allow the command to be executed
+type AccessDeniedError struct {
+	Action string
+	Reason string
+}
+
+func (e *AccessDeniedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("you are not allowed to %s", e.Action)
+	}
+	return fmt.Sprintf("you are not allowed to %s: %s", e.Action, e.Reason)
+}
+
+// CheckAccess asks the API server whether the command would be allowed before it's executed when access reviews are enabled.
+// When impersonation is enabled a SubjectAccessReview is created for the requester's kubernetes user with the given clients,
+// otherwise a SelfSubjectAccessReview is created for the user of the given clients.
+// An *AccessDeniedError is returned if the command would be denied.
+func CheckAccess(clients k8s.Clients, requester Requester, command Command) error {
+	p := currentPermissions()
+	if !p.AccessReview {
+		return nil
+	}
+
+	attributes, err := resourceAttributes(clients, command)
+	if err != nil {
+		return err
+	}
+
+	var review *k8s.AccessReview
+	if p.Impersonation.Enabled {
+		user, ok := p.Impersonation.UserFor(requester.AADObjectID, requester.Name)
+		if !ok {
+			return errors.New(fmt.Sprintf("permission error - %s is not mapped to a kubernetes user", requesterName(requester)))
+		}
+		review, err = k8s.ReviewSubjectAccess(clients.Kubernetes, user.Username, user.Groups, attributes)
+	} else {
+		review, err = k8s.ReviewSelfAccess(clients.Kubernetes, attributes)
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to review access: %v", err))
+	}
+
+	if !review.Allowed {
+		return &AccessDeniedError{Action: describePermission(command), Reason: review.Reason}
+	}
+	return nil
+}
+
+// resourceAttributes describes the kubernetes API request that executing the command requires
+func resourceAttributes(clients k8s.Clients, command Command) (authorizationv1.ResourceAttributes, error) {
+	attributes := authorizationv1.ResourceAttributes{
+		Namespace: command.Namespace,
+		Name:      command.Name,
+	}
+
+	switch command.Resource {
+	case "pod", "pods":
+		attributes.Resource = "pods"
+	case "deploy", "deployment", "deployments":
+		attributes.Group = "apps"
+		attributes.Resource = "deployments"
+	default:
+		mapping, err := k8s.ResolveResource(clients, command.Resource)
+		if err != nil {
+			return authorizationv1.ResourceAttributes{}, err
+		}
+		attributes.Group = mapping.Resource.Group
+		attributes.Version = mapping.Resource.Version
+		attributes.Resource = mapping.Resource.Resource
+	}
+
+	switch command.Verb {
+	case "get":
+		attributes.Verb = "get"
+		if command.Name == "" {
+			attributes.Verb = "list"
+		}
+	case "delete":
+		attributes.Verb = "delete"
+	case "describe":
+		attributes.Verb = "get"
+	case "logs":
+		attributes.Verb = "get"
+		attributes.Subresource = "log"
+	case "scale":
+		attributes.Verb = "patch"
+	case "rollout":
+		switch command.Subcommand {
+		case "restart", "undo":
+			attributes.Verb = "patch"
+		default:
+			attributes.Verb = "get"
+		}
+	default:
+		return authorizationv1.ResourceAttributes{}, errors.New(fmt.Sprintf("unable to review access for verb: %s", command.Verb))
+	}
+	return attributes, nil
+}
@@ -0,0 +1,200 @@
+package command
+
+import (
+	"errors"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const accessReviewPermissions = `
+verbs:
+  - "get"
+  - "delete"
+  - "logs"
+  - "rollout restart"
+resources:
+  - "pods"
+  - "deployments"
+namespaces:
+  - "default"
+accessReview: true
+`
+
+// accessReviewClient returns a fake client that allows the actions in allowed and records the attributes it reviewed
+func accessReviewClient(allowed []authorizationv1.ResourceAttributes, reviewed *[]authorizationv1.ResourceAttributes) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	review := func(attributes authorizationv1.ResourceAttributes) authorizationv1.SubjectAccessReviewStatus {
+		*reviewed = append(*reviewed, attributes)
+		for _, a := range allowed {
+			if reflect.DeepEqual(a, attributes) {
+				return authorizationv1.SubjectAccessReviewStatus{Allowed: true}
+			}
+		}
+		return authorizationv1.SubjectAccessReviewStatus{Reason: "no RBAC policy matched"}
+	}
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ssar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		ssar.Status = review(*ssar.Spec.ResourceAttributes)
+		return true, ssar, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := *sar.Spec.ResourceAttributes
+		if sar.Spec.User != "jane@example.com" {
+			attributes.Verb = "user " + sar.Spec.User // never allowed
+		}
+		sar.Status = review(attributes)
+		return true, sar, nil
+	})
+	return client
+}
+
+func TestCheckAccess(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, accessReviewPermissions))()
+
+	allowed := []authorizationv1.ResourceAttributes{
+		{Namespace: "default", Verb: "list", Resource: "pods"},
+		{Namespace: "default", Name: "nginx", Verb: "get", Resource: "pods", Subresource: "log"},
+		{Namespace: "default", Name: "nginx", Verb: "patch", Group: "apps", Resource: "deployments"},
+	}
+
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"get pods default", true},
+		{"get pods default nginx", false},
+		{"delete pods default nginx", false},
+		{"logs default nginx", true},
+		{"rollout restart default nginx", true},
+		{"rollout restart default redis", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			var reviewed []authorizationv1.ResourceAttributes
+			client := accessReviewClient(allowed, &reviewed)
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			err = CheckAccess(k8s.Clients{Kubernetes: client}, testRequester, parsed)
+			if len(reviewed) != 1 {
+				t.Fatalf("expected a single access review, got %d", len(reviewed))
+			}
+			if test.allowed && err != nil {
+				t.Fatalf("expected command to be allowed: %v", err)
+			}
+			if !test.allowed {
+				if _, ok := err.(*AccessDeniedError); !ok {
+					t.Fatalf("expected an access denied error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAccessDeniedMessage(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, accessReviewPermissions))()
+
+	var reviewed []authorizationv1.ResourceAttributes
+	client := accessReviewClient(nil, &reviewed)
+	parsed, err := parseCommand("delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	err = CheckAccess(k8s.Clients{Kubernetes: client}, testRequester, parsed)
+	expected := "you are not allowed to delete pods/nginx in namespace default: no RBAC policy matched"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %s, got %v", expected, err)
+	}
+}
+
+func TestCheckAccessImpersonation(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, accessReviewPermissions+`
+impersonation:
+  enabled: true
+  users:
+    - name: "Jane SRE"
+      username: "jane-by-name@example.com"
+    - aadObjectId: "6a1f1b3c-2d4e-4f50-8a6b-7c8d9e0f1a2b"
+      username: "jane@example.com"
+`))()
+
+	allowed := []authorizationv1.ResourceAttributes{
+		{Namespace: "default", Name: "nginx", Verb: "delete", Resource: "pods"},
+	}
+	parsed, err := parseCommand("delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+
+	var reviewed []authorizationv1.ResourceAttributes
+	err = CheckAccess(k8s.Clients{Kubernetes: accessReviewClient(allowed, &reviewed)}, sre, parsed)
+	if err != nil {
+		t.Fatalf("expected command to be allowed for the impersonated user: %v", err)
+	}
+	err = CheckAccess(k8s.Clients{Kubernetes: accessReviewClient(allowed, &reviewed)}, sreByName, parsed)
+	if _, ok := err.(*AccessDeniedError); !ok {
+		t.Fatalf("expected command to be denied for another impersonated user, got %v", err)
+	}
+	err = CheckAccess(k8s.Clients{Kubernetes: accessReviewClient(allowed, &reviewed)}, junior, parsed)
+	if err == nil {
+		t.Fatalf("expected command to be denied for a requester without a mapping")
+	}
+}
+
+func TestCheckAccessDisabled(t *testing.T) {
+	var reviewed []authorizationv1.ResourceAttributes
+	parsed, err := parseCommand("delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	err = CheckAccess(k8s.Clients{Kubernetes: accessReviewClient(nil, &reviewed)}, testRequester, parsed)
+	if err != nil || len(reviewed) != 0 {
+		t.Fatalf("expected no access review when access reviews are disabled")
+	}
+}
+
+func TestExecuteCommandForbidden(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "nginx", errors.New("denied by RBAC"))
+	})
+	parsed, err := parseCommand("delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	_, err = ExecuteCommand(k8s.Clients{Kubernetes: client}, parsed)
+	if _, ok := err.(*AccessDeniedError); !ok {
+		t.Fatalf("expected an access denied error, got %v", err)
+	}
+}
+
+func TestHandlerExecuteForbidden(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "nginx", errors.New("denied by RBAC"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader("delete pods default nginx"))
+	rr := httptest.NewRecorder()
+	Handler(k8s.Clients{Kubernetes: client}, rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("handler returned wrong status code: got %v expected %v", rr.Code, http.StatusForbidden)
+	}
+	if response := rr.Body.String(); !strings.HasPrefix(response, "you are not allowed to delete pods") {
+		t.Errorf("handler returned unexpected body: %s", response)
+	}
+}
@@ -0,0 +1,97 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const KontrolAnnotateDeploymentsEnvKey = "TEAMS_KONTROL_ANNOTATE_DEPLOYMENTS"
+
+var annotateDeployments bool
+
+// RecordAction records an event on the object changed by a mutating command so that cluster operators can see it came from teams.
+// Deployments are also annotated with who changed them last when TEAMS_KONTROL_ANNOTATE_DEPLOYMENTS is TRUE.
+// The clients should be teams-kontrol's own as the requester may not be allowed to create events.
+func RecordAction(clients k8s.Clients, requester Requester, command Command, result interface{}) error {
+	if !isMutating(command) {
+		return nil
+	}
+
+	var approver *Requester
+	if approved, ok := result.(*ApprovedCommand); ok {
+		result = approved.Result
+		approver = approved.Approval.Approver
+	}
+	object, err := involvedObject(clients, command, result)
+	if err != nil {
+		return err
+	}
+
+	_, err = k8s.RecordActionEvent(clients.Kubernetes, object, actionMessage(requester, approver, command))
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to record event for %s: %v", describePermission(command), err))
+	}
+
+	if annotateDeployments && object.Kind == "Deployment" && command.Verb != "delete" {
+		err = k8s.AnnotateDeployment(clients.Kubernetes, object.Namespace, object.Name, k8s.LastActionByAnnotation, requesterName(requester))
+		if err != nil {
+			return errors.New(fmt.Sprintf("failed to annotate deployment %s: %v", object.Name, err))
+		}
+	}
+	return nil
+}
+
+// involvedObject returns a reference to the object changed by the command
+// deployments are taken from the result so that the reference includes their UID
+func involvedObject(clients k8s.Clients, command Command, result interface{}) (v1.ObjectReference, error) {
+	switch castResult := result.(type) {
+	case *k8s.DeploymentScale:
+		return deploymentReference(castResult.Deployment), nil
+	case *k8s.DeploymentRestart:
+		return deploymentReference(castResult.Deployment), nil
+	case *k8s.DeploymentRollback:
+		return deploymentReference(castResult.Deployment), nil
+	}
+
+	object := v1.ObjectReference{Namespace: command.Namespace, Name: command.Name}
+	switch command.Resource {
+	case "pod", "pods":
+		object.APIVersion = "v1"
+		object.Kind = "Pod"
+	default:
+		mapping, err := k8s.ResolveResource(clients, command.Resource)
+		if err != nil {
+			return v1.ObjectReference{}, err
+		}
+		object.APIVersion = mapping.GroupVersionKind.GroupVersion().String()
+		object.Kind = mapping.GroupVersionKind.Kind
+	}
+	return object, nil
+}
+
+func deploymentReference(deployment *appsv1.Deployment) v1.ObjectReference {
+	return v1.ObjectReference{
+		APIVersion:      "apps/v1",
+		Kind:            "Deployment",
+		Namespace:       deployment.Namespace,
+		Name:            deployment.Name,
+		UID:             deployment.UID,
+		ResourceVersion: deployment.ResourceVersion,
+	}
+}
+
+// actionMessage describes the command and who sent it from teams. i.e.
+// Restart deployment nginx in namespace default - requested from Teams by Daniel Cole in channel 19:abc@thread.skype
+func actionMessage(requester Requester, approver *Requester, command Command) string {
+	message := fmt.Sprintf("%s - requested from Teams by %s", describeEffect(command), requesterName(requester))
+	if requester.ChannelID != "" {
+		message += fmt.Sprintf(" in channel %s", requester.ChannelID)
+	}
+	if approver != nil {
+		message += fmt.Sprintf(", approved by %s", requesterName(*approver))
+	}
+	return message
+}
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+var channelRequester = Requester{AADObjectID: testRequester.AADObjectID, Name: testRequester.Name, ChannelID: "19:abc@thread.skype"}
+
+// executeAndRecord executes the command and records the action as the requester
+func executeAndRecord(t *testing.T, clients k8s.Clients, requester Requester, text string) {
+	t.Helper()
+	command, err := parseCommand(text)
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	result, err := ExecuteCommand(clients, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+	err = RecordAction(clients, requester, command, result)
+	if err != nil {
+		t.Fatalf("failed to record action: %v", err)
+	}
+}
+
+func TestRecordActionScale(t *testing.T) {
+	client := fake.NewSimpleClientset(simpleDeployment("nginx", "nginx", 3))
+	executeAndRecord(t, k8s.Clients{Kubernetes: client}, channelRequester, "scale nginx nginx --replicas=5")
+
+	events, err := client.CoreV1().Events("nginx").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("expected 1 event, instead got %d", len(events.Items))
+	}
+	event := events.Items[0]
+	if event.Reason != k8s.ActionEventReason || event.Type != v1.EventTypeNormal {
+		t.Errorf("expected a normal %s event, instead got %s %s", k8s.ActionEventReason, event.Type, event.Reason)
+	}
+	if event.InvolvedObject.Kind != "Deployment" || event.InvolvedObject.Name != "nginx" || event.InvolvedObject.Namespace != "nginx" {
+		t.Errorf("expected event to involve deployment nginx, instead got %+v", event.InvolvedObject)
+	}
+	expected := "Scale deployment nginx in namespace nginx to 5 replicas - requested from Teams by Test User in channel 19:abc@thread.skype"
+	if event.Message != expected {
+		t.Errorf("expected message %s, instead got %s", expected, event.Message)
+	}
+
+	deployment, err := client.AppsV1().Deployments("nginx").Get("nginx", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if _, ok := deployment.Annotations[k8s.LastActionByAnnotation]; ok {
+		t.Error("expected deployment not to be annotated unless enabled")
+	}
+}
+
+func TestRecordActionAnnotatesDeployment(t *testing.T) {
+	annotateDeployments = true
+	defer func() {
+		annotateDeployments = false
+	}()
+
+	client := fake.NewSimpleClientset(simpleDeployment("nginx", "nginx", 3))
+	executeAndRecord(t, k8s.Clients{Kubernetes: client}, channelRequester, "rollout restart nginx nginx")
+
+	deployment, err := client.AppsV1().Deployments("nginx").Get("nginx", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if by := deployment.Annotations[k8s.LastActionByAnnotation]; by != "Test User" {
+		t.Errorf("expected deployment to be annotated with the requester, instead got '%s'", by)
+	}
+}
+
+func TestRecordActionDeletePod(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"}})
+	executeAndRecord(t, k8s.Clients{Kubernetes: client}, testRequester, "delete pods default nginx")
+
+	events, err := client.CoreV1().Events("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+	if len(events.Items) != 1 || events.Items[0].InvolvedObject.Kind != "Pod" {
+		t.Fatalf("expected 1 event involving the pod, instead got %+v", events.Items)
+	}
+}
+
+func TestRecordActionIgnoresReads(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"}})
+	executeAndRecord(t, k8s.Clients{Kubernetes: client}, testRequester, "get pods default")
+
+	events, err := client.CoreV1().Events("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+	if len(events.Items) != 0 {
+		t.Errorf("expected no events for commands that don't change the cluster, instead got %d", len(events.Items))
+	}
+}
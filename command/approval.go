@@ -0,0 +1,184 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const KontrolApprovalTimeoutEnvKey = "TEAMS_KONTROL_APPROVAL_TIMEOUT"
+const defaultApprovalTimeout = time.Hour
+
+// ApprovalRequest is a mutating command in a protected namespace waiting for another user to approve it
+type ApprovalRequest struct {
+	ID          string     `json:"id"`
+	Command     Command    `json:"command"`
+	Text        string     `json:"text"`
+	Requester   Requester  `json:"requester"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	Expires     time.Time  `json:"expires"`
+	Approver    *Requester `json:"approver,omitempty"`
+	ApprovedAt  time.Time  `json:"approvedAt,omitempty"`
+	// Elevation is set instead of the command when the approval is for an elevation
+	Elevation *ElevationRequest `json:"elevation,omitempty"`
+}
+
+func (a *ApprovalRequest) expired() bool {
+	return !now().Before(a.Expires)
+}
+
+// ApprovedCommand is the result of a command that was executed once it was approved
+type ApprovedCommand struct {
+	Approval *ApprovalRequest
+	Result   interface{}
+}
+
+// approvalTimeout returns how long an approval request can be approved for
+func approvalTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv(KontrolApprovalTimeoutEnvKey))
+	if err != nil || timeout <= 0 {
+		return defaultApprovalTimeout
+	}
+	return timeout
+}
+
+// isMutating returns whether the command changes the cluster
+func isMutating(command Command) bool {
+	switch command.Action() {
+	case "delete", "scale", "rollout restart", "rollout undo":
+		return true
+	default:
+		return false
+	}
+}
+
+// RequiresApproval returns whether the command changes a namespace that's protected by the permissions
+func RequiresApproval(command Command) bool {
+	return isMutating(command) && currentPermissions().Approval.Namespaces.Matches(command.Namespace)
+}
+
+// RequestApproval stores the command until another user approves or rejects it or it expires
+func RequestApproval(requester Requester, command Command, text string) (*ApprovalRequest, error) {
+	id, err := newConfirmationID()
+	if err != nil {
+		return nil, err
+	}
+	approval := &ApprovalRequest{
+		ID:          id,
+		Command:     command,
+		Text:        text,
+		Requester:   requester,
+		RequestedAt: now(),
+		Expires:     now().Add(approvalTimeout()),
+	}
+	err = approvals.Save(approval)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to save approval request: %v", err))
+	}
+	return approval, nil
+}
+
+// Approve removes the approval request so that the command can be executed and records the approver.
+// The approver can't be the requester and must be permitted to execute the command themselves.
+// The command is parsed again as the permissions may have changed since it was requested.
+// checkAccess, when given, is called with the requester and the command before the request is removed,
+// so that the request stays pending if it fails. Its error is returned unchanged. i.e. CheckAccess
+// Approving an elevation grants it and returns the *Elevation instead of a command.
+func Approve(approver Requester, id string, checkAccess func(requester Requester, command Command) error) (*ApprovalRequest, Command, error) {
+	approval, err := pendingApproval(id)
+	if err != nil {
+		return nil, Command{}, err
+	}
+	if sameRequester(approval.Requester, approver) {
+		return nil, Command{}, errors.New(fmt.Sprintf("command %s must be approved by someone other than %s", id, requesterName(approval.Requester)))
+	}
+	if approval.Elevation != nil {
+		return approveElevationRequest(approver, approval)
+	}
+	command, err := ParseAndValidateCommandFromString(approval.Requester, approval.Text)
+	if err != nil {
+		return nil, Command{}, err
+	}
+	err = authorize(effectivePermissions(), approver, command)
+	if err != nil {
+		return nil, Command{}, errors.New(fmt.Sprintf("%s isn't permitted to approve command %s: %v", requesterName(approver), id, err))
+	}
+	if checkAccess != nil {
+		err = checkAccess(approval.Requester, command)
+		if err != nil {
+			return nil, Command{}, err
+		}
+	}
+
+	err = takeApproval(id)
+	if err != nil {
+		return nil, Command{}, err
+	}
+	approval.Approver = &approver
+	approval.ApprovedAt = now()
+	return approval, command, nil
+}
+
+// Reject discards the approval request. The requester can withdraw it, otherwise the user rejecting it must be
+// permitted to execute the command themselves.
+func Reject(rejecter Requester, id string) (*ApprovalRequest, error) {
+	approval, err := pendingApproval(id)
+	if err != nil {
+		return nil, err
+	}
+	if !sameRequester(approval.Requester, rejecter) {
+		err = canReject(rejecter, approval)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s isn't permitted to reject command %s: %v", requesterName(rejecter), id, err))
+		}
+	}
+	return approval, takeApproval(id)
+}
+
+// pendingApproval returns the approval request if it exists and hasn't expired
+func pendingApproval(id string) (*ApprovalRequest, error) {
+	approval, err := approvals.Get(id)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to get approval request %s: %v", id, err))
+	}
+	if approval == nil || approval.expired() {
+		return nil, errors.New(fmt.Sprintf("there's no command %s waiting for approval, it may have expired or already been approved", id))
+	}
+	return approval, nil
+}
+
+// takeApproval removes the approval request, failing if another user made a decision on it first
+func takeApproval(id string) error {
+	deleted, err := approvals.Delete(id)
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to remove approval request %s: %v", id, err))
+	}
+	if !deleted {
+		return errors.New(fmt.Sprintf("there's no command %s waiting for approval, it may have already been approved", id))
+	}
+	return nil
+}
+
+// approveElevationRequest grants the elevation and records the approver
+func approveElevationRequest(approver Requester, approval *ApprovalRequest) (*ApprovalRequest, Command, error) {
+	elevation, err := approveElevation(approver, approval)
+	if err != nil {
+		return nil, Command{}, err
+	}
+	approval.Approver = &approver
+	approval.ApprovedAt = elevation.Granted
+	return approval, Command{}, nil
+}
+
+// canReject returns an error if the user isn't permitted to reject the approval request
+func canReject(rejecter Requester, approval *ApprovalRequest) error {
+	if approval.Elevation == nil {
+		return authorize(effectivePermissions(), rejecter, approval.Command)
+	}
+	role, ok := currentPermissions().Elevation.Role(approval.Elevation.Role)
+	if !ok || !canApproveElevation(rejecter, role) {
+		return errors.New(fmt.Sprintf("%s isn't an approver of role %s", requesterName(rejecter), approval.Elevation.Role))
+	}
+	return nil
+}
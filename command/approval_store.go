@@ -0,0 +1,145 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/config"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	"os"
+	"sync"
+)
+
+const KontrolApprovalConfigMapEnvKey = "TEAMS_KONTROL_APPROVAL_CONFIGMAP"
+
+// ApprovalStore holds the commands that are waiting for approval
+type ApprovalStore interface {
+	// Save stores the approval request
+	Save(approval *ApprovalRequest) error
+	// Get returns the approval request or nil if it doesn't exist
+	Get(id string) (*ApprovalRequest, error)
+	// Delete removes the approval request and returns whether it existed so that only one decision is made on it
+	Delete(id string) (bool, error)
+}
+
+// approvals stores the pending approval requests. Requests are kept in memory unless InitApprovalStore configures a config map.
+var approvals ApprovalStore = newMemoryApprovalStore()
+
+// InitApprovalStore stores approval requests in the config map named by TEAMS_KONTROL_APPROVAL_CONFIGMAP so that they
+// survive a restart. An error is returned when the permissions require approvals and it isn't set, pending approvals
+// would otherwise be lost on every restart. Approval requests are kept in memory when nothing requires approval.
+func InitApprovalStore(clients k8s.Clients) error {
+	value := os.Getenv(KontrolApprovalConfigMapEnvKey)
+	if value == "" {
+		if requiresApprovals(currentPermissions()) {
+			return errors.New(fmt.Sprintf("%s must be set when the permissions require approval", KontrolApprovalConfigMapEnvKey))
+		}
+		return nil
+	}
+	namespace, name, err := splitNamespacedName(value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid %s: %v", KontrolApprovalConfigMapEnvKey, err))
+	}
+	approvals = &configMapApprovalStore{clients: clients, namespace: namespace, name: name}
+	return nil
+}
+
+// requiresApprovals returns whether any command or elevation has to be approved with the given permissions
+func requiresApprovals(p config.Permissions) bool {
+	if len(p.Approval.Namespaces) > 0 {
+		return true
+	}
+	for _, role := range p.Elevation.Roles {
+		if role.RequireApproval {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryApprovalStore keeps approval requests in memory
+type memoryApprovalStore struct {
+	sync.Mutex
+	requests map[string]*ApprovalRequest
+}
+
+func newMemoryApprovalStore() *memoryApprovalStore {
+	return &memoryApprovalStore{requests: map[string]*ApprovalRequest{}}
+}
+
+func (s *memoryApprovalStore) Save(approval *ApprovalRequest) error {
+	s.Lock()
+	defer s.Unlock()
+	for id, request := range s.requests {
+		if request.expired() {
+			delete(s.requests, id)
+		}
+	}
+	s.requests[approval.ID] = approval
+	return nil
+}
+
+func (s *memoryApprovalStore) Get(id string) (*ApprovalRequest, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.requests[id], nil
+}
+
+func (s *memoryApprovalStore) Delete(id string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.requests[id]
+	delete(s.requests, id)
+	return ok, nil
+}
+
+// configMapApprovalStore keeps each approval request as JSON under its ID in a config map
+type configMapApprovalStore struct {
+	clients   k8s.Clients
+	namespace string
+	name      string
+}
+
+func (s *configMapApprovalStore) Save(approval *ApprovalRequest) error {
+	encoded, err := json.Marshal(approval)
+	if err != nil {
+		return err
+	}
+	return k8s.UpdateConfigMapData(s.clients.Kubernetes, s.namespace, s.name, func(data map[string]string) (bool, error) {
+		for id, value := range data {
+			var request ApprovalRequest
+			if json.Unmarshal([]byte(value), &request) != nil || request.expired() {
+				delete(data, id)
+			}
+		}
+		data[approval.ID] = string(encoded)
+		return true, nil
+	})
+}
+
+func (s *configMapApprovalStore) Get(id string) (*ApprovalRequest, error) {
+	data, err := k8s.GetConfigMapData(s.clients.Kubernetes, s.namespace, s.name)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[id]
+	if !ok {
+		return nil, nil
+	}
+	var approval ApprovalRequest
+	err = json.Unmarshal([]byte(value), &approval)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to decode approval request %s: %v", id, err))
+	}
+	return &approval, nil
+}
+
+func (s *configMapApprovalStore) Delete(id string) (bool, error) {
+	deleted := false
+	err := k8s.UpdateConfigMapData(s.clients.Kubernetes, s.namespace, s.name, func(data map[string]string) (bool, error) {
+		_, deleted = data[id]
+		delete(data, id)
+		return deleted, nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,240 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const approvalPermissions = `
+verbs:
+  - "get"
+  - "delete"
+  - "scale"
+resources:
+  - "pods"
+  - "deployments"
+namespaces:
+  - "default"
+  - "prod-*"
+rules:
+  - subjects:
+      - name: "Joe Junior"
+    deny: true
+    verbs:
+      - "delete"
+    resources:
+      - "*"
+    namespaces:
+      - "*"
+approval:
+  namespaces:
+    - "prod-*"
+`
+
+// useTestApprovalStore swaps in the approval store and returns a function that restores the original store
+func useTestApprovalStore(store ApprovalStore) func() {
+	original := approvals
+	approvals = store
+	return func() {
+		approvals = original
+	}
+}
+
+func TestRequiresApproval(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, approvalPermissions))()
+
+	tests := []struct {
+		command  string
+		required bool
+	}{
+		{"get pods prod-payments", false},
+		{"delete pods prod-payments payments-1", true},
+		{"scale prod-payments payments --replicas=3", true},
+		{"delete pods default nginx", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			if RequiresApproval(parsed) != test.required {
+				t.Errorf("expected approval required to be %t", test.required)
+			}
+		})
+	}
+}
+
+func TestInitApprovalStore(t *testing.T) {
+	defer useTestApprovalStore(newMemoryApprovalStore())()
+	defer os.Unsetenv(KontrolApprovalConfigMapEnvKey)
+	clients := k8s.Clients{Kubernetes: fake.NewSimpleClientset()}
+
+	os.Unsetenv(KontrolApprovalConfigMapEnvKey)
+	if err := InitApprovalStore(clients); err != nil {
+		t.Fatalf("expected approvals to be kept in memory when nothing requires approval: %v", err)
+	}
+
+	defer useTestPermissions(loadTestPermissions(t, approvalPermissions))()
+	if err := InitApprovalStore(clients); err == nil {
+		t.Fatalf("expected the approval store to require a config map when the permissions require approval")
+	}
+
+	os.Setenv(KontrolApprovalConfigMapEnvKey, "teams-kontrol/approvals")
+	if err := InitApprovalStore(clients); err != nil {
+		t.Fatalf("failed to initialise approval store: %v", err)
+	}
+	if _, ok := approvals.(*configMapApprovalStore); !ok {
+		t.Errorf("expected approvals to be stored in a config map, instead got %T", approvals)
+	}
+}
+
+func TestHandlerRejectsCommandRequiringApproval(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, approvalPermissions))()
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "payments-1", Namespace: "prod-payments"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader("delete pods prod-payments payments-1"))
+	rr := httptest.NewRecorder()
+	Handler(k8s.Clients{Kubernetes: client}, rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("handler returned wrong status code: got %v expected %v", rr.Code, http.StatusForbidden)
+	}
+	_, err := client.CoreV1().Pods("prod-payments").Get("payments-1", metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("expected the pod to not be deleted without approval: %v", err)
+	}
+}
+
+// testApprovals requests approval of the command with each store
+func testApprovals(t *testing.T, test func(t *testing.T, approval *ApprovalRequest)) {
+	stores := map[string]ApprovalStore{
+		"memory":    newMemoryApprovalStore(),
+		"configmap": &configMapApprovalStore{clients: k8s.Clients{Kubernetes: fake.NewSimpleClientset()}, namespace: "teams-kontrol", name: "approvals"},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			defer useTestApprovalStore(store)()
+			parsed, err := parseCommand("delete pods prod-payments payments-1")
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			approval, err := RequestApproval(testRequester, parsed, "delete pods prod-payments payments-1")
+			if err != nil {
+				t.Fatalf("failed to request approval: %v", err)
+			}
+			test(t, approval)
+		})
+	}
+}
+
+func TestApprove(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, approvalPermissions))()
+
+	testApprovals(t, func(t *testing.T, approval *ApprovalRequest) {
+		_, _, err := Approve(testRequester, approval.ID, nil)
+		if err == nil {
+			t.Fatalf("expected the requester to be unable to approve their own command")
+		}
+		_, _, err = Approve(junior, approval.ID, nil)
+		if err == nil {
+			t.Fatalf("expected a user who can't execute the command to be unable to approve it")
+		}
+
+		approved, command, err := Approve(sre, approval.ID, nil)
+		if err != nil {
+			t.Fatalf("failed to approve command: %v", err)
+		}
+		if command.Name != "payments-1" || approved.Approver == nil || approved.Approver.Name != sre.Name {
+			t.Errorf("expected the approved command and approver to be returned, got %v %v", command, approved.Approver)
+		}
+		if approved.Requester != testRequester {
+			t.Errorf("expected the requester to be kept, got %v", approved.Requester)
+		}
+
+		_, _, err = Approve(sre, approval.ID, nil)
+		if err == nil {
+			t.Fatalf("expected the command to only be approved once")
+		}
+	})
+}
+
+func TestReject(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, approvalPermissions))()
+
+	testApprovals(t, func(t *testing.T, approval *ApprovalRequest) {
+		_, err := Reject(junior, approval.ID)
+		if err == nil {
+			t.Fatalf("expected a user who can't execute the command to be unable to reject it")
+		}
+		_, err = Reject(testRequester, approval.ID)
+		if err != nil {
+			t.Fatalf("expected the requester to be able to withdraw their command: %v", err)
+		}
+		_, _, err = Approve(sre, approval.ID, nil)
+		if err == nil {
+			t.Fatalf("expected a rejected command to be unable to be approved")
+		}
+	})
+}
+
+func TestApproveExpired(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, approvalPermissions))()
+
+	testApprovals(t, func(t *testing.T, approval *ApprovalRequest) {
+		originalNow := now
+		defer func() { now = originalNow }()
+		now = func() time.Time {
+			return approval.Expires
+		}
+
+		_, _, err := Approve(sre, approval.ID, nil)
+		if err == nil {
+			t.Fatalf("expected an expired command to be unable to be approved")
+		}
+	})
+}
+
+func TestConfigMapApprovalStoreSurvivesRestart(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, approvalPermissions))()
+	client := fake.NewSimpleClientset()
+
+	defer useTestApprovalStore(&configMapApprovalStore{clients: k8s.Clients{Kubernetes: client}, namespace: "teams-kontrol", name: "approvals"})()
+	parsed, err := parseCommand("delete pods prod-payments payments-1")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	approval, err := RequestApproval(testRequester, parsed, "delete pods prod-payments payments-1")
+	if err != nil {
+		t.Fatalf("failed to request approval: %v", err)
+	}
+
+	configMap, err := client.CoreV1().ConfigMaps("teams-kontrol").Get("approvals", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the approval request to be stored in a config map: %v", err)
+	}
+	if _, ok := configMap.Data[approval.ID]; !ok {
+		t.Fatalf("expected the config map to contain approval request %s", approval.ID)
+	}
+
+	// a new store reading the same config map is equivalent to a restart
+	approvals = &configMapApprovalStore{clients: k8s.Clients{Kubernetes: client}, namespace: "teams-kontrol", name: "approvals"}
+	approved, _, err := Approve(sre, approval.ID, nil)
+	if err != nil {
+		t.Fatalf("failed to approve command after a restart: %v", err)
+	}
+	if approved.Requester != testRequester || approved.Text != approval.Text {
+		t.Errorf("expected the approval request to be restored, got %v", approved)
+	}
+}
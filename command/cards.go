@@ -0,0 +1,614 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/card"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"strings"
+	"time"
+)
+
+// now is used to calculate the age of resources and is replaced in tests so that cards are consistent
+var now = time.Now
+
+// renderCard marshals the given card so it can be sent as a teams attachment
+func renderCard(c *card.Card) ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// podListCard returns an adaptive card with the details of each pod in a separate container
+func podListCard(podList []v1.Pod) *card.Card {
+	body := []card.Element{card.Title("Pod Detail")}
+	for _, pod := range podList {
+		body = append(body, card.Container{
+			Style: "emphasis",
+			Items: []card.Element{
+				card.FactSet{
+					Facts: []card.Fact{
+						{Title: "Name", Value: pod.Name},
+						{Title: "Age", Value: pod.CreationTimestamp.String()},
+						{Title: "Status", Value: string(pod.Status.Phase)},
+						{Title: "Namespace", Value: pod.Namespace},
+					},
+				},
+			},
+		})
+	}
+	return card.New(body...)
+}
+
+// podLogsCard returns an adaptive card with the end of the pod logs in a monospace block
+func podLogsCard(podLogs *k8s.PodLogs) *card.Card {
+	facts := []card.Fact{
+		{Title: "Pod", Value: podLogs.Name},
+		{Title: "Namespace", Value: podLogs.Namespace},
+	}
+	if podLogs.Container != "" {
+		facts = append(facts, card.Fact{Title: "Container", Value: podLogs.Container})
+	}
+	if podLogs.Previous {
+		facts = append(facts, card.Fact{Title: "Previous", Value: "true"})
+	}
+
+	body := []card.Element{
+		card.Title("Pod Logs"),
+		card.FactSet{Facts: facts},
+	}
+
+	logs, truncated := truncateLogs(podLogs.Logs, maxLogBytes)
+	if truncated {
+		body = append(body, card.TextBlock{
+			Text:     fmt.Sprintf("Logs truncated to the last %d bytes", maxLogBytes),
+			Wrap:     true,
+			IsSubtle: true,
+		})
+	}
+	if logs == "" {
+		logs = "No logs found"
+	}
+	body = append(body, card.Container{
+		Style: "emphasis",
+		Items: []card.Element{
+			card.TextBlock{
+				Text:     logs,
+				Wrap:     true,
+				FontType: "Monospace",
+			},
+		},
+	})
+
+	c := card.New(body...)
+	c.MSTeams = &card.MSTeams{Width: "Full"}
+	return c
+}
+
+// podDescriptionCard returns an adaptive card similar to the output of kubectl describe pod
+func podDescriptionCard(description *k8s.PodDescription) *card.Card {
+	pod := description.Pod
+
+	body := []card.Element{
+		card.Title("Pod Description"),
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Name", Value: pod.Name},
+				{Title: "Namespace", Value: pod.Namespace},
+				{Title: "Node", Value: pod.Spec.NodeName},
+				{Title: "Created", Value: pod.CreationTimestamp.String()},
+				{Title: "Status", Value: string(pod.Status.Phase)},
+				{Title: "Pod IP", Value: pod.Status.PodIP},
+				{Title: "Host IP", Value: pod.Status.HostIP},
+			},
+		},
+		sectionHeading("Containers"),
+	}
+
+	statuses := map[string]v1.ContainerStatus{}
+	for _, status := range pod.Status.ContainerStatuses {
+		statuses[status.Name] = status
+	}
+	for _, container := range pod.Spec.Containers {
+		status := statuses[container.Name]
+		body = append(body, card.Container{
+			Style: "emphasis",
+			Items: []card.Element{
+				card.FactSet{
+					Facts: []card.Fact{
+						{Title: "Name", Value: container.Name},
+						{Title: "Image", Value: container.Image},
+						{Title: "State", Value: containerState(status.State)},
+						{Title: "Ready", Value: fmt.Sprintf("%t", status.Ready)},
+						{Title: "Restart Count", Value: fmt.Sprintf("%d", status.RestartCount)},
+					},
+				},
+			},
+		})
+	}
+
+	if len(pod.Status.Conditions) > 0 {
+		var rows [][]string
+		for _, condition := range pod.Status.Conditions {
+			rows = append(rows, []string{string(condition.Type), string(condition.Status)})
+		}
+		body = append(body, sectionHeading("Conditions"), card.NewTable([]string{"Type", "Status"}, rows))
+	}
+
+	body = append(body, eventElements(description.Events)...)
+
+	c := card.New(body...)
+	c.MSTeams = &card.MSTeams{Width: "Full"}
+	return c
+}
+
+// eventElements returns a heading and a table of the given events
+func eventElements(events []v1.Event) []card.Element {
+	if len(events) == 0 {
+		return []card.Element{sectionHeading("Events"), card.TextBlock{Text: "No events found", IsSubtle: true}}
+	}
+	var rows [][]string
+	for _, event := range events {
+		rows = append(rows, []string{
+			event.Type,
+			event.Reason,
+			k8s.EventTime(event).String(),
+			event.Message,
+		})
+	}
+	return []card.Element{sectionHeading("Events"), card.NewTable([]string{"Type", "Reason", "Last Seen", "Message"}, rows)}
+}
+
+func sectionHeading(text string) card.TextBlock {
+	return card.TextBlock{
+		Text:      text,
+		Size:      "Medium",
+		Weight:    "Bolder",
+		Separator: true,
+	}
+}
+
+// containerState returns a short description of the container state. i.e. Waiting (CrashLoopBackOff)
+func containerState(state v1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "Running"
+	case state.Waiting != nil:
+		return fmt.Sprintf("Waiting (%s)", state.Waiting.Reason)
+	case state.Terminated != nil:
+		return fmt.Sprintf("Terminated (%s, exit code %d)", state.Terminated.Reason, state.Terminated.ExitCode)
+	default:
+		return "Unknown"
+	}
+}
+
+// age returns the human readable time since the timestamp. i.e. 3d4h
+func age(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(now().Sub(timestamp.Time))
+}
+
+// deploymentImages returns the images of all containers in the deployment's pod template
+func deploymentImages(deployment *appsv1.Deployment) string {
+	var images []string
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		images = append(images, container.Image)
+	}
+	return strings.Join(images, ", ")
+}
+
+// desiredReplicas returns the replicas specified for the deployment which defaults to 1
+func desiredReplicas(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
+
+func deploymentFacts(deployment *appsv1.Deployment) []card.Fact {
+	return []card.Fact{
+		{Title: "Name", Value: deployment.Name},
+		{Title: "Namespace", Value: deployment.Namespace},
+		{Title: "Desired", Value: fmt.Sprintf("%d", desiredReplicas(deployment))},
+		{Title: "Ready", Value: fmt.Sprintf("%d", deployment.Status.ReadyReplicas)},
+		{Title: "Updated", Value: fmt.Sprintf("%d", deployment.Status.UpdatedReplicas)},
+		{Title: "Available", Value: fmt.Sprintf("%d", deployment.Status.AvailableReplicas)},
+		{Title: "Images", Value: deploymentImages(deployment)},
+		{Title: "Age", Value: age(deployment.CreationTimestamp)},
+	}
+}
+
+// deploymentCard returns an adaptive card with the replicas and images of a single deployment
+func deploymentCard(deployment *appsv1.Deployment) *card.Card {
+	return card.New(
+		card.Title("Deployment Detail"),
+		card.FactSet{Facts: deploymentFacts(deployment)},
+	)
+}
+
+// deploymentListCard returns an adaptive card with a table row for each deployment like kubectl get deployments
+func deploymentListCard(deployments []appsv1.Deployment) *card.Card {
+	if len(deployments) == 0 {
+		return card.New(card.Title("Deployments"), card.TextBlock{Text: "No deployments found", IsSubtle: true})
+	}
+
+	var rows [][]string
+	for i := range deployments {
+		deployment := &deployments[i]
+		rows = append(rows, []string{
+			deployment.Name,
+			fmt.Sprintf("%d/%d", deployment.Status.ReadyReplicas, desiredReplicas(deployment)),
+			fmt.Sprintf("%d", deployment.Status.UpdatedReplicas),
+			fmt.Sprintf("%d", deployment.Status.AvailableReplicas),
+			deploymentImages(deployment),
+			age(deployment.CreationTimestamp),
+		})
+	}
+
+	c := card.New(
+		card.Title("Deployments"),
+		card.TextBlock{Text: fmt.Sprintf("Namespace: %s", deployments[0].Namespace), IsSubtle: true},
+		card.NewTable([]string{"Name", "Ready", "Up-to-date", "Available", "Images", "Age"}, rows),
+	)
+	c.MSTeams = &card.MSTeams{Width: "Full"}
+	return c
+}
+
+// deploymentScaleCard returns an adaptive card showing the replicas before and after scaling a deployment
+func deploymentScaleCard(scale *k8s.DeploymentScale) *card.Card {
+	deployment := scale.Deployment
+	return card.New(
+		card.Title("Deployment Scaled"),
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Name", Value: deployment.Name},
+				{Title: "Namespace", Value: deployment.Namespace},
+				{Title: "Previous Replicas", Value: fmt.Sprintf("%d", scale.PreviousReplicas)},
+				{Title: "Replicas", Value: fmt.Sprintf("%d", desiredReplicas(deployment))},
+			},
+		},
+	)
+}
+
+// deploymentRestartCard returns an adaptive card confirming that a rollout restart was triggered
+func deploymentRestartCard(restart *k8s.DeploymentRestart) *card.Card {
+	deployment := restart.Deployment
+	return card.New(
+		card.Title("Deployment Restarted"),
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Name", Value: deployment.Name},
+				{Title: "Namespace", Value: deployment.Namespace},
+				{Title: "Restarted At", Value: restart.RestartedAt.UTC().Format(time.RFC3339)},
+				{Title: "Images", Value: deploymentImages(deployment)},
+			},
+		},
+	)
+}
+
+// rolloutStatusCard returns an adaptive card describing the progress of a deployment rollout
+func rolloutStatusCard(status *k8s.DeploymentRolloutStatus) *card.Card {
+	color := "Warning"
+	if status.Complete {
+		color = "Good"
+	}
+	return card.New(
+		card.Title("Rollout Status"),
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Name", Value: status.Deployment.Name},
+				{Title: "Namespace", Value: status.Deployment.Namespace},
+				{Title: "Revision", Value: status.Deployment.Annotations[k8s.RevisionAnnotation]},
+			},
+		},
+		card.TextBlock{Text: status.Message, Wrap: true, Color: color},
+	)
+}
+
+// rolloutHistoryCard returns an adaptive card with a table row for each revision of a deployment
+func rolloutHistoryCard(history *k8s.DeploymentHistory) *card.Card {
+	body := []card.Element{
+		card.Title("Rollout History"),
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Name", Value: history.Deployment.Name},
+				{Title: "Namespace", Value: history.Deployment.Namespace},
+				{Title: "Current Revision", Value: history.Deployment.Annotations[k8s.RevisionAnnotation]},
+			},
+		},
+	}
+
+	if len(history.Revisions) == 0 {
+		body = append(body, card.TextBlock{Text: "No rollout history found", IsSubtle: true})
+	} else {
+		var rows [][]string
+		for _, revision := range history.Revisions {
+			changeCause := revision.ChangeCause
+			if changeCause == "" {
+				changeCause = "<none>"
+			}
+			rows = append(rows, []string{
+				fmt.Sprintf("%d", revision.Revision),
+				changeCause,
+				strings.Join(revision.Images, ", "),
+				age(revision.Created),
+			})
+		}
+		body = append(body, card.NewTable([]string{"Revision", "Change Cause", "Images", "Age"}, rows))
+	}
+
+	c := card.New(body...)
+	c.MSTeams = &card.MSTeams{Width: "Full"}
+	return c
+}
+
+// rolloutUndoCard returns an adaptive card showing the images before and after a deployment was rolled back
+func rolloutUndoCard(rollback *k8s.DeploymentRollback) *card.Card {
+	return card.New(
+		card.Title("Rollout Undone"),
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Name", Value: rollback.Deployment.Name},
+				{Title: "Namespace", Value: rollback.Deployment.Namespace},
+				{Title: "From Revision", Value: fmt.Sprintf("%d", rollback.FromRevision)},
+				{Title: "To Revision", Value: fmt.Sprintf("%d", rollback.ToRevision)},
+			},
+		},
+		card.ColumnSet{
+			Columns: []card.Column{
+				imagesColumn("Before", rollback.PreviousImages),
+				imagesColumn("After", rollback.Images),
+			},
+		},
+	)
+}
+
+func imagesColumn(heading string, images []string) card.Column {
+	items := []card.Element{card.TextBlock{Text: heading, Weight: "Bolder"}}
+	for _, image := range images {
+		items = append(items, card.TextBlock{Text: image, Wrap: true, FontType: "Monospace"})
+	}
+	return card.Column{Items: items, Width: "stretch"}
+}
+
+// resourceStatus returns a short status for any resource from its phase or ready condition if it has either
+func resourceStatus(resource *unstructured.Unstructured) string {
+	if phase, found, _ := unstructured.NestedString(resource.Object, "status", "phase"); found && phase != "" {
+		return phase
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == "True" {
+			return "Ready"
+		}
+		if reason, ok := condition["reason"].(string); ok && reason != "" {
+			return fmt.Sprintf("Not Ready (%s)", reason)
+		}
+		return "Not Ready"
+	}
+	return "-"
+}
+
+// resourceCard returns a generic adaptive card for any resource without a specialised card
+func resourceCard(resource *unstructured.Unstructured) *card.Card {
+	return card.New(
+		card.Title(fmt.Sprintf("%s Detail", resource.GetKind())),
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Name", Value: resource.GetName()},
+				{Title: "Namespace", Value: resource.GetNamespace()},
+				{Title: "Kind", Value: resource.GetKind()},
+				{Title: "API Version", Value: resource.GetAPIVersion()},
+				{Title: "Status", Value: resourceStatus(resource)},
+				{Title: "Age", Value: age(resource.GetCreationTimestamp())},
+			},
+		},
+	)
+}
+
+// resourceListCard returns a generic adaptive card with a table row for each resource
+func resourceListCard(resources []unstructured.Unstructured) *card.Card {
+	if len(resources) == 0 {
+		return card.New(card.Title("Resources"), card.TextBlock{Text: "No resources found", IsSubtle: true})
+	}
+
+	var rows [][]string
+	for i := range resources {
+		resource := &resources[i]
+		rows = append(rows, []string{
+			resource.GetName(),
+			resourceStatus(resource),
+			age(resource.GetCreationTimestamp()),
+		})
+	}
+
+	c := card.New(
+		card.Title(resources[0].GetKind()),
+		card.TextBlock{Text: fmt.Sprintf("Namespace: %s", resources[0].GetNamespace()), IsSubtle: true},
+		card.NewTable([]string{"Name", "Status", "Age"}, rows),
+	)
+	c.MSTeams = &card.MSTeams{Width: "Full"}
+	return c
+}
+
+// confirmationCard describes what the pending command will do with buttons to confirm or cancel it.
+// Replying with confirm or cancel followed by the ID works the same as the buttons.
+func confirmationCard(pending *PendingCommand) *card.Card {
+	c := card.New(
+		card.Title("Confirm Command"),
+		card.TextBlock{Text: describeEffect(pending.Command), Wrap: true, Weight: "Bolder", Color: "Attention"},
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Command", Value: pending.Text},
+				{Title: "Requested By", Value: requesterName(pending.Requester)},
+				{Title: "Expires In", Value: duration.HumanDuration(pending.Expires.Sub(now()).Round(time.Second))},
+				{Title: "ID", Value: pending.ID},
+			},
+		},
+		card.TextBlock{
+			Text:     fmt.Sprintf("Only %s can confirm. Reply with confirm %s or cancel %s if the buttons aren't available.", requesterName(pending.Requester), pending.ID, pending.ID),
+			Wrap:     true,
+			IsSubtle: true,
+		},
+	)
+	c.Actions = []card.Action{
+		card.Submit{
+			Title: "Confirm",
+			Style: "destructive",
+			Data:  decisionData(ConfirmAction, pending.ID),
+		},
+		card.Submit{
+			Title: "Cancel",
+			Data:  decisionData(CancelAction, pending.ID),
+		},
+	}
+	return c
+}
+
+// approvalCard describes what the command waiting for approval will do with buttons to approve or reject it.
+// Replying with approve or reject followed by the ID works the same as the buttons.
+func approvalCard(approval *ApprovalRequest) *card.Card {
+	if approval.Elevation != nil {
+		return elevationApprovalCard(approval)
+	}
+	c := card.New(
+		card.Title("Approval Required"),
+		card.TextBlock{Text: describeEffect(approval.Command), Wrap: true, Weight: "Bolder", Color: "Attention"},
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Command", Value: approval.Text},
+				{Title: "Requested By", Value: requesterName(approval.Requester)},
+				{Title: "Expires In", Value: duration.HumanDuration(approval.Expires.Sub(now()).Round(time.Second))},
+				{Title: "ID", Value: approval.ID},
+			},
+		},
+		card.TextBlock{
+			Text: fmt.Sprintf("Namespace %s is protected so this command must be approved by someone other than %s who is permitted to execute it. "+
+				"Reply with approve %s or reject %s if the buttons aren't available.",
+				approval.Command.Namespace, requesterName(approval.Requester), approval.ID, approval.ID),
+			Wrap:     true,
+			IsSubtle: true,
+		},
+	)
+	c.Actions = []card.Action{
+		card.Submit{
+			Title: "Approve",
+			Style: "positive",
+			Data:  decisionData(ApproveAction, approval.ID),
+		},
+		card.Submit{
+			Title: "Reject",
+			Style: "destructive",
+			Data:  decisionData(RejectAction, approval.ID),
+		},
+	}
+	return c
+}
+
+// approvedCard adds who requested and approved the command to the card of its result
+// a card is created for commands without a result. i.e. delete
+func approvedCard(approval *ApprovalRequest, resultCard *card.Card) *card.Card {
+	if resultCard == nil && approval.Elevation != nil {
+		resultCard = card.New(
+			card.Title("Elevated Access Granted"),
+			card.TextBlock{Text: describeElevation(*approval.Elevation), Wrap: true},
+			card.FactSet{
+				Facts: []card.Fact{
+					{Title: "Reason", Value: approval.Elevation.Reason},
+					{Title: "Expires In", Value: duration.HumanDuration(approval.ApprovedAt.Add(approval.Elevation.Duration).Sub(now()).Round(time.Second))},
+				},
+			},
+		)
+	}
+	if resultCard == nil {
+		resultCard = card.New(
+			card.Title("Command Approved"),
+			card.TextBlock{Text: describeEffect(approval.Command), Wrap: true},
+		)
+	}
+	approver := ""
+	if approval.Approver != nil {
+		approver = requesterName(*approval.Approver)
+	}
+	resultCard.Body = append(resultCard.Body, card.Container{
+		Separator: true,
+		Items: []card.Element{
+			card.FactSet{
+				Facts: []card.Fact{
+					{Title: "Command", Value: approval.Text},
+					{Title: "Requested By", Value: requesterName(approval.Requester)},
+					{Title: "Approved By", Value: approver},
+				},
+			},
+		},
+	})
+	return resultCard
+}
+
+// elevationApprovalCard describes the elevation waiting for approval with buttons to approve or reject it
+func elevationApprovalCard(approval *ApprovalRequest) *card.Card {
+	c := card.New(
+		card.Title("Approval Required"),
+		card.TextBlock{Text: describeElevation(*approval.Elevation), Wrap: true, Weight: "Bolder", Color: "Attention"},
+		card.FactSet{
+			Facts: []card.Fact{
+				{Title: "Reason", Value: approval.Elevation.Reason},
+				{Title: "Requested By", Value: requesterName(approval.Requester)},
+				{Title: "Expires In", Value: duration.HumanDuration(approval.Expires.Sub(now()).Round(time.Second))},
+				{Title: "ID", Value: approval.ID},
+			},
+		},
+		card.TextBlock{
+			Text: fmt.Sprintf("Role %s must be approved by one of its approvers other than %s. "+
+				"Reply with approve %s or reject %s if the buttons aren't available.",
+				approval.Elevation.Role, requesterName(approval.Requester), approval.ID, approval.ID),
+			Wrap:     true,
+			IsSubtle: true,
+		},
+	)
+	c.Actions = []card.Action{
+		card.Submit{
+			Title: "Approve",
+			Style: "positive",
+			Data:  decisionData(ApproveAction, approval.ID),
+		},
+		card.Submit{
+			Title: "Reject",
+			Style: "destructive",
+			Data:  decisionData(RejectAction, approval.ID),
+		},
+	}
+	return c
+}
+
+// elevationCard describes the role granted to the requester and when it expires
+func elevationCard(elevation *Elevation) *card.Card {
+	facts := []card.Fact{
+		{Title: "Role", Value: elevation.Role},
+		{Title: "Granted To", Value: requesterName(elevation.Requester)},
+		{Title: "Reason", Value: elevation.Reason},
+		{Title: "Expires In", Value: duration.HumanDuration(elevation.Expires.Sub(now()).Round(time.Second))},
+	}
+	if elevation.Approver != nil {
+		facts = append(facts, card.Fact{Title: "Approved By", Value: requesterName(*elevation.Approver)})
+	}
+	return card.New(
+		card.Title("Elevated Access Granted"),
+		card.FactSet{Facts: facts},
+		card.TextBlock{
+			Text:     fmt.Sprintf("The access granted by role %s is revoked automatically when it expires.", elevation.Role),
+			Wrap:     true,
+			IsSubtle: true,
+		},
+	)
+}
@@ -0,0 +1,140 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// run 'go test ./command -update' to regenerate the golden files after changing a card
+var update = flag.Bool("update", false, "update golden files in testdata/golden")
+
+var goldenCreationTimestamp = metav1.NewTime(time.Date(2020, 3, 18, 2, 8, 55, 0, time.UTC))
+
+func TestPodListCardGolden(t *testing.T) {
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "nginx-9ffc7d87b-fw2vd",
+				Namespace:         "default",
+				CreationTimestamp: goldenCreationTimestamp,
+			},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		},
+	}
+	assertGoldenCard(t, "pod.json", podListCard(pods))
+}
+
+func TestPodListCardGoldenMultiple(t *testing.T) {
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "nginx-1",
+				Namespace:         "nginx",
+				CreationTimestamp: goldenCreationTimestamp,
+			},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		},
+		{
+			// values that would have broken the old text/template rendering
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              `nginx-"2"\`,
+				Namespace:         "nginx",
+				CreationTimestamp: goldenCreationTimestamp,
+			},
+			Status: v1.PodStatus{Phase: "Pending\nUnschedulable"},
+		},
+	}
+	assertGoldenCard(t, "pod_list.json", podListCard(pods))
+}
+
+// assertGoldenCard compares the indented json of the card with the golden file of the same name
+func assertGoldenCard(t *testing.T, name string, c interface{}) {
+	t.Helper()
+
+	out, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal card: %v", err)
+	}
+	out = append(out, '\n')
+
+	golden := filepath.Join("testdata", "golden", name)
+	if *update {
+		err = ioutil.WriteFile(golden, out, 0644)
+		if err != nil {
+			t.Fatalf("failed to update golden file %s: %v", golden, err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s: %v", golden, err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("card does not match golden file %s\ngot:\n%s\nexpected:\n%s", golden, out, expected)
+	}
+}
+
+func TestConfirmationCard(t *testing.T) {
+	parsed, err := parseCommand("scale default nginx --replicas=0")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	pending := &PendingCommand{
+		ID:        "1a2b3c4d",
+		Command:   parsed,
+		Text:      "scale default nginx --replicas=0",
+		Requester: sre,
+		Expires:   now().Add(5 * time.Minute),
+	}
+	assertGoldenCard(t, "confirmation.json", confirmationCard(pending))
+}
+
+func TestApprovalCards(t *testing.T) {
+	parsed, err := parseCommand("delete pods prod-payments payments-1")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	approval := &ApprovalRequest{
+		ID:          "1a2b3c4d",
+		Command:     parsed,
+		Text:        "delete pods prod-payments payments-1",
+		Requester:   testRequester,
+		RequestedAt: now(),
+		Expires:     now().Add(time.Hour),
+	}
+	assertGoldenCard(t, "approval.json", approvalCard(approval))
+
+	approval.Approver = &sre
+	approval.ApprovedAt = now()
+	assertGoldenCard(t, "approved.json", approvedCard(approval, nil))
+}
+
+func TestElevationCards(t *testing.T) {
+	elevation := &Elevation{
+		ID:        "5e6f7a8b",
+		Role:      "incident",
+		Reason:    "database is down",
+		Requester: testRequester,
+		Approver:  &sre,
+		Granted:   now(),
+		Expires:   now().Add(time.Hour),
+	}
+	assertGoldenCard(t, "elevation.json", elevationCard(elevation))
+
+	approval := &ApprovalRequest{
+		ID:          "1a2b3c4d",
+		Text:        `elevate admin 30m "restore backups"`,
+		Requester:   testRequester,
+		RequestedAt: now(),
+		Expires:     now().Add(time.Hour),
+		Elevation:   &ElevationRequest{Role: "admin", Duration: 30 * time.Minute, Reason: "restore backups"},
+	}
+	assertGoldenCard(t, "elevation_approval.json", approvalCard(approval))
+}
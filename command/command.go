@@ -1,65 +1,86 @@
 package command
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/daniel-cole/teams-kontrol/config"
+	"github.com/daniel-cole/teams-kontrol/audit"
+	"github.com/daniel-cole/teams-kontrol/card"
 	"github.com/daniel-cole/teams-kontrol/k8s"
 	"github.com/daniel-cole/teams-kontrol/middleware"
 	"github.com/daniel-cole/teams-kontrol/util"
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"net/http"
 	"os"
 	"reflect"
-	"strings"
-	"text/template"
 )
 
 type Command struct {
 	Verb       string
+	Subcommand string
 	Resource   string
 	Namespace  string
-	Identifier string
+	Name       string
+	Flags      map[string]string
+}
+
+// Action returns the verb including the subcommand if there is one. i.e. rollout restart
+func (c Command) Action() string {
+	if c.Subcommand == "" {
+		return c.Verb
+	}
+	return c.Verb + " " + c.Subcommand
 }
 
 const KontrolPermissionFileEnvKey = "TEAMS_KONTROL_PERMISSION_FILE"
 const KontrolInsecureCommandHandlerEnvKey = "TEAMS_KONTROL_INSECURE_COMMANDS"
 const KontrolResponseTypeEnvKey = "TEAMS_KONTROL_RESPONSE_TYPE"
-const verbPermissionIndex = 0
-const resourcePermissionIndex = 1
-const namespacePermissionIndex = 2
+const KontrolPermissionReloadIntervalEnvKey = "TEAMS_KONTROL_PERMISSION_RELOAD_INTERVAL"
+const KontrolPermissionConfigMapEnvKey = "TEAMS_KONTROL_PERMISSION_CONFIGMAP"
+const KontrolPermissionConfigMapKeyEnvKey = "TEAMS_KONTROL_PERMISSION_CONFIGMAP_KEY"
+const KontrolPermissionPolicyEnvKey = "TEAMS_KONTROL_PERMISSION_POLICY"
 const teamsResponseType = "TEAMS"
 
 var responseType string
-var permissions config.Permissions
+var permissionFile string
+var permissionConfigMap string
+var permissionPolicy string
 
 // Init will ensure that there's a Command file. The program will crash if it is not specified.
+// The file isn't required when the permissions are loaded from a config map or KontrolPolicy by WatchPermissions.
 func Init() {
-	var permissionFile string
-	if permissionFile = os.Getenv(KontrolPermissionFileEnvKey); permissionFile == "" {
-		logrus.Fatalf("Exiting. Please specify a permissions file with %s", KontrolPermissionFileEnvKey)
+	permissionConfigMap = os.Getenv(KontrolPermissionConfigMapEnvKey)
+	permissionPolicy = os.Getenv(KontrolPermissionPolicyEnvKey)
+	if permissionConfigMap != "" && permissionPolicy != "" {
+		logrus.Fatalf("Exiting. Only one of %s and %s can be specified", KontrolPermissionConfigMapEnvKey, KontrolPermissionPolicyEnvKey)
 	}
-	permissionsFromFile, err := ioutil.ReadFile(permissionFile)
-	if err != nil {
-		logrus.Fatalf("Failed to read Command file: %v", err)
-	}
-	err = yaml.Unmarshal(permissionsFromFile, &permissions)
-	if err != nil {
-		logrus.Fatalf("Failed to unmarshal json for Command file %v", err)
+
+	if permissionConfigMap == "" && permissionPolicy == "" {
+		if permissionFile = os.Getenv(KontrolPermissionFileEnvKey); permissionFile == "" {
+			logrus.Fatalf("Exiting. Please specify a permissions file with %s", KontrolPermissionFileEnvKey)
+		}
+		permissionsFromFile, err := ioutil.ReadFile(permissionFile)
+		if err != nil {
+			logrus.Fatalf("Failed to read Command file: %v", err)
+		}
+		err = UpdatePermissions(permissionsFromFile, permissionFile)
+		if err != nil {
+			logrus.Fatalf("Failed to load Command file: %v", err)
+		}
 	}
 
 	if responseType = os.Getenv(KontrolResponseTypeEnvKey); responseType == "" {
 		responseType = teamsResponseType // default to teams
 	}
+
+	annotateDeployments = os.Getenv(KontrolAnnotateDeploymentsEnvKey) == "TRUE"
 }
 
-func Handler(client kubernetes.Interface, w http.ResponseWriter, r *http.Request) {
+func Handler(clients k8s.Clients, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	if r.Method != http.MethodPost {
@@ -76,27 +97,86 @@ func Handler(client kubernetes.Interface, w http.ResponseWriter, r *http.Request
 	}
 
 	commandStr := string(body)
-	command, err := parseAndValidateCommandFromString(commandStr)
+	event := audit.NewEvent(ctx, audit.CommandEvent)
+	event.RawText = commandStr
+	event.Text = commandStr
+	defer audit.Record(event)
+
+	// the insecure handler has no way of identifying the requester so only permissions granted to everyone apply
+	command, err := ParseAndValidateCommandFromString(Requester{}, commandStr)
 	if err != nil {
-		errorMsg := fmt.Sprintf("failed to parse and validate command: '%s'", commandStr)
+		event.Decide(audit.DecisionDenied, err)
+		errorMsg := fmt.Sprintf("failed to parse and validate command: '%s', got %v", commandStr, err)
 		middleware.LogWithContext(ctx).Error(errorMsg)
 		http.Error(w, errorMsg, http.StatusBadRequest)
 		return
 	}
 
-	result, err := ExecuteCommand(client, command)
+	event.Command = command
+	// there's no way to request or give approval through the insecure handler so protected namespaces can't be changed
+	if RequiresApproval(command) {
+		err = errors.New(fmt.Sprintf("%s in namespace %s requires approval and can't be executed through the /command endpoint", command.Action(), command.Namespace))
+		event.Decide(audit.DecisionDenied, err)
+		middleware.LogWithContext(ctx).Error(err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	err = CheckAccess(clients, Requester{}, command)
+	if err != nil {
+		errorMsg := fmt.Sprintf("failed to check access for command: '%s', got %v", commandStr, err)
+		middleware.LogWithContext(ctx).Error(errorMsg)
+		status := http.StatusInternalServerError
+		event.Fail(err)
+		if _, ok := err.(*AccessDeniedError); ok {
+			status = http.StatusForbidden
+			event.Decide(audit.DecisionDenied, err)
+		}
+		http.Error(w, errorMsg, status)
+		return
+	}
+
+	event.Decide(audit.DecisionAllowed, nil)
+	requesterClients, err := ClientsFor(clients, Requester{})
+	if err != nil {
+		event.Fail(err)
+		errorMsg := fmt.Sprintf("failed to get clients: %v", err)
+		middleware.LogWithContext(ctx).Error(errorMsg)
+		http.Error(w, errorMsg, http.StatusForbidden)
+		return
+	}
+
+	result, err := ExecuteCommand(requesterClients, command)
 	if err != nil {
 		errorMsg := fmt.Sprintf("failed to execute command: %s, got %v", commandStr, err)
 		middleware.LogWithContext(ctx).Error(errorMsg)
-		http.Error(w, errorMsg, http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		event.Fail(err)
+		if _, ok := err.(*AccessDeniedError); ok {
+			// kubernetes RBAC denied the command, the message explains what the requester isn't allowed to do
+			status = http.StatusForbidden
+			errorMsg = err.Error()
+			event.Decide(audit.DecisionDenied, err)
+		}
+		http.Error(w, errorMsg, status)
 		return
 	}
 
+	err = RecordAction(clients, Requester{}, command, result)
+	if err != nil {
+		middleware.LogWithContext(ctx).Warnf("failed to record action for command: '%s', got %v", commandStr, err)
+	}
+
 	response, err := PrepareResponse(result)
 	if err != nil {
+		event.Fail(err)
 		errorMsg := fmt.Sprintf("failed to prepare response: %v", err)
 		middleware.LogWithContext(ctx).Error(errorMsg)
 		http.Error(w, errorMsg, http.StatusInternalServerError)
+		return
+	}
+	if response == nil {
+		response = []byte("ok") // if nil then we presume that the command was executed successfully
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -106,124 +186,211 @@ func Handler(client kubernetes.Interface, w http.ResponseWriter, r *http.Request
 
 // PrepareResponse takes an interface and attempts to render the appropriate response and returns it as a byte array
 // i.e. if teamsResponseType == "TEAMS" and the interface is a pod then it will return a teams card with the pod details
+// nil is returned when there's nothing to render
 func PrepareResponse(result interface{}) ([]byte, error) {
 	switch responseType {
 	case teamsResponseType:
-		switch castResult := result.(type) {
-		case *v1.Pod:
-			return renderTeamsPodCard([]v1.Pod{*castResult})
-		case *v1.PodList:
-			return renderTeamsPodCard(castResult.Items)
-		case nil:
-			return []byte("ok"), nil // if nil then we presume that the command was executed successfully
-		default:
-			return nil, errors.New(fmt.Sprintf("unknown type returned from execute command: %s", reflect.TypeOf(castResult)))
+		c, err := responseCard(result)
+		if err != nil || c == nil {
+			return nil, err
 		}
+		return renderCard(c)
 	default:
 		return nil, errors.New("unknown response type: " + responseType)
 	}
 }
 
+// responseCard returns the teams card for the result or nil when there's nothing to render
+func responseCard(result interface{}) (*card.Card, error) {
+	switch castResult := result.(type) {
+	case *v1.Pod:
+		return podListCard([]v1.Pod{*castResult}), nil
+	case *v1.PodList:
+		return podListCard(castResult.Items), nil
+	case *appsv1.Deployment:
+		return deploymentCard(castResult), nil
+	case *appsv1.DeploymentList:
+		return deploymentListCard(castResult.Items), nil
+	case *k8s.DeploymentScale:
+		return deploymentScaleCard(castResult), nil
+	case *k8s.DeploymentRestart:
+		return deploymentRestartCard(castResult), nil
+	case *k8s.DeploymentRolloutStatus:
+		return rolloutStatusCard(castResult), nil
+	case *k8s.DeploymentHistory:
+		return rolloutHistoryCard(castResult), nil
+	case *k8s.DeploymentRollback:
+		return rolloutUndoCard(castResult), nil
+	case *unstructured.Unstructured:
+		return resourceCard(castResult), nil
+	case *unstructured.UnstructuredList:
+		return resourceListCard(castResult.Items), nil
+	case *k8s.PodDescription:
+		return podDescriptionCard(castResult), nil
+	case *k8s.PodLogs:
+		return podLogsCard(castResult), nil
+	case *PendingCommand:
+		return confirmationCard(castResult), nil
+	case *ApprovalRequest:
+		return approvalCard(castResult), nil
+	case *Elevation:
+		return elevationCard(castResult), nil
+	case *ApprovedCommand:
+		resultCard, err := responseCard(castResult.Result)
+		if err != nil {
+			return nil, err
+		}
+		return approvedCard(castResult.Approval, resultCard), nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown type returned from execute command: %s", reflect.TypeOf(castResult)))
+	}
+}
+
 // Execute takes a valid command and attempts to execute it
 // returns an interface containing a list of pods, a pod, or an error if it's failed.
 // if nil, nil is returned then the command likely didn't return anything in the first place. i.e. delete
-func ExecuteCommand(client kubernetes.Interface, command Command) (interface{}, error) {
+// get and delete for resources without specific support are executed with the dynamic client
+// an *AccessDeniedError is returned if the API server forbids the command
+func ExecuteCommand(clients k8s.Clients, command Command) (interface{}, error) {
+	result, err := executeCommand(clients, command)
+	if apierrors.IsForbidden(err) {
+		return nil, &AccessDeniedError{Action: describePermission(command)}
+	}
+	return result, err
+}
+
+func executeCommand(clients k8s.Clients, command Command) (interface{}, error) {
+	client := clients.Kubernetes
+
 	switch command.Verb {
 	case "get":
 		switch command.Resource {
 		case "pod", "pods":
-			if command.Identifier != "" {
-				return k8s.GetPod(client, command.Namespace, command.Identifier)
+			if command.Name != "" {
+				return k8s.GetPod(client, command.Namespace, command.Name)
+			} else {
+				return k8s.GetPods(client, command.Namespace, listOptions(command))
+			}
+		case "deploy", "deployment", "deployments":
+			if command.Name != "" {
+				return k8s.GetDeployment(client, command.Namespace, command.Name)
 			} else {
-				return k8s.GetPods(client, command.Namespace)
+				return k8s.GetDeployments(client, command.Namespace, listOptions(command))
 			}
 		default:
-			return nil, errors.New(fmt.Sprintf("failed to execute command - unknown resource: %s", command.Resource))
+			if command.Name != "" {
+				return k8s.GetResource(clients, command.Resource, command.Namespace, command.Name)
+			} else {
+				return k8s.GetResources(clients, command.Resource, command.Namespace, listOptions(command))
+			}
 		}
 
 	case "delete":
+		if command.Name == "" {
+			return nil, errors.New(fmt.Sprintf("attempted delete command execution without name specified: %v", command))
+		}
 		switch command.Resource {
 		case "pod", "pods":
-			if command.Identifier == "" {
-				return nil, errors.New(fmt.Sprintf("attempted delete command execution without identifier specified: %v", command))
+			return nil, k8s.DeletePod(client, command.Namespace, command.Name)
+		default:
+			return nil, k8s.DeleteResource(clients, command.Resource, command.Namespace, command.Name)
+		}
+
+	case "describe":
+		switch command.Resource {
+		case "pod", "pods":
+			if command.Name == "" {
+				return nil, errors.New(fmt.Sprintf("attempted describe command execution without name specified: %v", command))
 			}
-			return nil, k8s.DeletePod(client, command.Namespace, command.Identifier)
+			return k8s.DescribePod(client, command.Namespace, command.Name)
 		default:
 			return nil, errors.New(fmt.Sprintf("failed to execute command - unknown resource: %s", command.Resource))
 		}
 
-	default:
-		return nil, errors.New(fmt.Sprintf("failed to execute command - unknown verb: %s", command.Verb))
-	}
-
-}
+	case "scale":
+		switch command.Resource {
+		case "deploy", "deployment", "deployments":
+			if command.Name == "" {
+				return nil, errors.New(fmt.Sprintf("attempted scale command execution without name specified: %v", command))
+			}
+			replicas, err := replicas(command)
+			if err != nil {
+				return nil, err
+			}
+			return k8s.ScaleDeployment(client, command.Namespace, command.Name, replicas)
+		default:
+			return nil, errors.New(fmt.Sprintf("failed to execute command - unknown resource: %s", command.Resource))
+		}
 
-// parseAndValidateCommandFromString parses a given string and returns the corresponding Command struct if valid
-func parseAndValidateCommandFromString(command string) (Command, error) {
+	case "rollout":
+		if command.Name == "" {
+			return nil, errors.New(fmt.Sprintf("attempted rollout command execution without name specified: %v", command))
+		}
+		switch command.Subcommand {
+		case "restart":
+			return k8s.RestartDeployment(client, command.Namespace, command.Name)
+		case "status":
+			return k8s.GetRolloutStatus(client, command.Namespace, command.Name)
+		case "history":
+			return k8s.GetRolloutHistory(client, command.Namespace, command.Name)
+		case "undo":
+			revision, err := toRevision(command)
+			if err != nil {
+				return nil, err
+			}
+			return k8s.RolloutUndo(client, command.Namespace, command.Name, revision)
+		default:
+			return nil, errors.New(fmt.Sprintf("failed to execute command - unknown rollout subcommand: %s", command.Subcommand))
+		}
 
-	commandArr := strings.Split(command, " ")
+	case "logs":
+		if command.Name == "" {
+			return nil, errors.New(fmt.Sprintf("attempted logs command execution without name specified: %v", command))
+		}
+		opts, err := podLogOptions(command)
+		if err != nil {
+			return nil, err
+		}
+		return k8s.GetPodLogs(client, command.Namespace, command.Name, opts)
 
-	withIdentifier := false
-	switch len(commandArr) {
-	case 3:
-		withIdentifier = false
-	case 4:
-		withIdentifier = true
 	default:
-		return Command{}, errors.New("unable to parse Command")
+		return nil, errors.New(fmt.Sprintf("failed to execute command - unknown verb: %s", command.Verb))
 	}
 
-	verb, err := checkPermission(commandArr, verbPermissionIndex, permissions.Verbs)
+}
+
+// ParseAndValidateCommandFromString parses a given string and returns the corresponding Command struct if
+// the requester is permitted to execute it. a *ParseError is returned if the command can't be parsed
+func ParseAndValidateCommandFromString(requester Requester, command string) (Command, error) {
+	parsed, err := parseCommand(command)
 	if err != nil {
 		return Command{}, err
 	}
-	resource, err := checkPermission(commandArr, resourcePermissionIndex, permissions.Resources)
+	// rules are matched against the canonical resource so that they can't be bypassed with another spelling of it
+	parsed.Resource, err = canonicalResource(parsed.Resource)
 	if err != nil {
 		return Command{}, err
 	}
-	namespace, err := checkPermission(commandArr, namespacePermissionIndex, permissions.Namespaces)
+
+	err = authorize(effectivePermissions(), requester, parsed)
 	if err != nil {
 		return Command{}, err
 	}
-	identifier := ""
-	if withIdentifier {
-		identifier = commandArr[3]
-	}
 
-	return Command{
-		Verb:       verb,
-		Resource:   resource,
-		Namespace:  namespace,
-		Identifier: identifier,
-	}, nil
+	return parsed, nil
 }
 
-func checkPermission(commandArr []string, idx int, allowedValues []string) (string, error) {
-	value := commandArr[idx]
+func checkPermission(kind string, value string, allowedValues []string) error {
 	valueSupported := util.StringInSliceIgnoreCase(value, allowedValues)
 	if !valueSupported {
-		return "", errors.New(fmt.Sprintf("permission error - unsupported value: %s at index %d", value, idx))
+		return errors.New(fmt.Sprintf("permission error - unsupported %s: %s", kind, value))
 	}
-	return value, nil
+	return nil
 }
 
-// renderteamsPodCard will render an adaptive teams card for each pod found
+// renderTeamsPodCard will render an adaptive teams card for each pod found
 func renderTeamsPodCard(podList []v1.Pod) ([]byte, error) {
-	tmpl := template.New("teams-adaptive-card-pod-list.tmpl")
-	tmpl, err := tmpl.Funcs(templateFns).Parse(teamsAdaptiveCardPodListTmpl)
-	if err != nil {
-		return nil, err
-	}
-
-	var tmplData bytes.Buffer
-	err = tmpl.Execute(&tmplData, podList)
-	if err != nil {
-		return nil, err
-	}
-
-	jsonTeamsCard, err := json.MarshalIndent(tmplData.String(), "", " ")
-	if err != nil {
-		return nil, err
-	}
-	return jsonTeamsCard, nil
+	return renderCard(podListCard(podList))
 }
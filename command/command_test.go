@@ -1,7 +1,9 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/daniel-cole/teams-kontrol/k8s"
 	"github.com/daniel-cole/teams-kontrol/util"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -10,8 +12,15 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
+// testRequester isn't the subject of any rules in testdata/permissions.yml so only the top level permissions apply
+var testRequester = Requester{
+	AADObjectID: "0f4f4a3e-61a4-4c4b-9b8e-3f7b1b1c0a01",
+	Name:        "Test User",
+}
+
 func TestMain(m *testing.M) {
 
 	teamsKontrolPermissionFile := "testdata/permissions.yml"
@@ -19,7 +28,15 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalf("Failed to set %s", KontrolPermissionFileEnvKey)
 	}
+	// resolve resources with the resources of the fake clients
+	discoveryClients = dynamicClients
 	Init()
+
+	// keep the age of resources consistent in the golden files
+	now = func() time.Time {
+		return goldenCreationTimestamp.Add(50 * time.Hour)
+	}
+
 	os.Exit(m.Run())
 }
 
@@ -27,7 +44,7 @@ func TestMain(m *testing.M) {
 func TestParseAndValidateGetPodCommandValid(t *testing.T) {
 	// valid Command: get pods default
 	validCommand := "get pods default"
-	command, err := parseAndValidateCommandFromString(validCommand)
+	command, err := ParseAndValidateCommandFromString(testRequester, validCommand)
 	if err != nil {
 		t.Fatalf("expected Command to be valid: %s", validCommand)
 	}
@@ -52,7 +69,7 @@ func TestParseAndValidateGetPodCommandValid(t *testing.T) {
 func TestParseAndValidateGetPodCommandValidIdent(t *testing.T) {
 	identifier := "redis-asdqwe-23dd2"
 	validCommand := fmt.Sprintf("describe pods redis %s", identifier)
-	command, err := parseAndValidateCommandFromString(validCommand)
+	command, err := ParseAndValidateCommandFromString(testRequester, validCommand)
 	if err != nil {
 		t.Fatalf("expected Command to be valid: %s", validCommand)
 	}
@@ -72,15 +89,15 @@ func TestParseAndValidateGetPodCommandValidIdent(t *testing.T) {
 		t.Errorf("expected namespace to be %s", expectedNamespace)
 	}
 
-	if identifier != command.Identifier {
-		t.Fatalf("expected identifier to be %s, instead got %s", identifier, command.Identifier)
+	if identifier != command.Name {
+		t.Fatalf("expected name to be %s, instead got %s", identifier, command.Name)
 	}
 }
 
 func TestParseAndValidatePodCommandInvalid(t *testing.T) {
 	// valid Command: get pods default
 	invalidCommand := "get pox default"
-	_, err := parseAndValidateCommandFromString(invalidCommand)
+	_, err := ParseAndValidateCommandFromString(testRequester, invalidCommand)
 	if err == nil {
 		t.Fatalf("expected Command to be invalid: %s", invalidCommand)
 	}
@@ -101,11 +118,11 @@ func TestExecuteGetPodsCommand(t *testing.T) {
 		}
 	}
 
-	command, err := parseAndValidateCommandFromString("get pods nginx")
+	command, err := ParseAndValidateCommandFromString(testRequester, "get pods nginx")
 	if err != nil {
 		t.Fatalf("failed to parse and validate command")
 	}
-	result, err := ExecuteCommand(client, command)
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
 	if err != nil {
 		t.Fatalf("failed to execute Command: %s. %v", command, err)
 	}
@@ -152,11 +169,11 @@ func TestExecuteGetPodCommand(t *testing.T) {
 		t.Fatalf("failed to create pod: %v", err)
 	}
 
-	command, err := parseAndValidateCommandFromString("get pod nginx nginx-ingress-controller-a12fb")
+	command, err := ParseAndValidateCommandFromString(testRequester, "get pod nginx nginx-ingress-controller-a12fb")
 	if err != nil {
 		t.Fatalf("failed to parse and validate command")
 	}
-	result, err := ExecuteCommand(client, command)
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
 	if err != nil {
 		t.Fatalf("failed to execute Command: %s. %v", command, err)
 	}
@@ -197,12 +214,19 @@ func TestRenderPodTeamsCard(t *testing.T) {
 		},
 	}
 
-	_, err := renderTeamsPodCard([]v1.Pod{pod})
+	out, err := renderTeamsPodCard([]v1.Pod{pod})
 	if err != nil {
 		t.Fatalf("failed to render teams card for pod: %v", err)
 	}
 
-	//fmt.Println(strconv.Unquote(string(out))) //useful for dumping formatted json
+	var card map[string]interface{}
+	err = json.Unmarshal(out, &card)
+	if err != nil {
+		t.Fatalf("expected teams card to be a json object: %v", err)
+	}
+	if card["type"] != "AdaptiveCard" {
+		t.Fatalf("expected teams card type to be AdaptiveCard, instead got %v", card["type"])
+	}
 
 }
 
@@ -276,11 +300,11 @@ func TestDeletePod(t *testing.T) {
 		t.Fatalf("failed to create pod: %v", err)
 	}
 
-	command, err := parseAndValidateCommandFromString("delete pod nginx " + podName)
+	command, err := ParseAndValidateCommandFromString(testRequester, "delete pod nginx "+podName)
 	if err != nil {
 		t.Fatalf("failed to parse and validate command: %v", err)
 	}
-	_, err = ExecuteCommand(client, command)
+	_, err = ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
 	if err != nil {
 		t.Fatalf("failed to execute Command: %s. %v", command, err)
 	}
@@ -0,0 +1,141 @@
+package command
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const KontrolConfirmationTimeoutEnvKey = "TEAMS_KONTROL_CONFIRMATION_TIMEOUT"
+const defaultConfirmationTimeout = 5 * time.Minute
+
+// PendingCommand is a destructive command waiting to be confirmed by the user that requested it
+type PendingCommand struct {
+	ID        string
+	Command   Command
+	Text      string
+	Requester Requester
+	Expires   time.Time
+}
+
+var pendingCommands = struct {
+	sync.Mutex
+	commands map[string]*PendingCommand
+}{commands: map[string]*PendingCommand{}}
+
+// confirmationTimeout returns how long a pending command can be confirmed for
+func confirmationTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv(KontrolConfirmationTimeoutEnvKey))
+	if err != nil || timeout <= 0 {
+		return defaultConfirmationTimeout
+	}
+	return timeout
+}
+
+// RequiresConfirmation returns whether the command is destructive and must be confirmed before it's executed
+// i.e. delete, scaling to zero replicas or undoing a rollout
+func RequiresConfirmation(command Command) bool {
+	switch command.Verb {
+	case "delete":
+		return true
+	case "scale":
+		replicas, err := replicas(command)
+		return err == nil && replicas == 0
+	case "rollout":
+		return command.Subcommand == "undo"
+	default:
+		return false
+	}
+}
+
+// RequestConfirmation holds the command until it's confirmed or cancelled by the requester or it expires
+func RequestConfirmation(requester Requester, command Command, text string) (*PendingCommand, error) {
+	id, err := newConfirmationID()
+	if err != nil {
+		return nil, err
+	}
+	pending := &PendingCommand{
+		ID:        id,
+		Command:   command,
+		Text:      text,
+		Requester: requester,
+		Expires:   now().Add(confirmationTimeout()),
+	}
+
+	pendingCommands.Lock()
+	defer pendingCommands.Unlock()
+	removeExpiredCommands()
+	pendingCommands.commands[id] = pending
+	return pending, nil
+}
+
+// TakePendingCommand removes and returns the pending command so that it can be executed or discarded.
+// Only the user that requested the command can take it and it must not have expired.
+func TakePendingCommand(requester Requester, id string) (*PendingCommand, error) {
+	pendingCommands.Lock()
+	defer pendingCommands.Unlock()
+	removeExpiredCommands()
+
+	pending, ok := pendingCommands.commands[id]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("there's no pending command %s, it may have expired or already been confirmed", id))
+	}
+	if !sameRequester(pending.Requester, requester) {
+		return nil, errors.New(fmt.Sprintf("only %s can confirm or cancel command %s", requesterName(pending.Requester), id))
+	}
+	delete(pendingCommands.commands, id)
+	return pending, nil
+}
+
+// removeExpiredCommands discards pending commands that can no longer be confirmed. pendingCommands must be locked.
+func removeExpiredCommands() {
+	current := now()
+	for id, pending := range pendingCommands.commands {
+		if !current.Before(pending.Expires) {
+			delete(pendingCommands.commands, id)
+		}
+	}
+}
+
+// sameRequester returns whether both requesters identify the same user, preferring the AAD object ID
+func sameRequester(a Requester, b Requester) bool {
+	if a.AADObjectID != "" || b.AADObjectID != "" {
+		return strings.EqualFold(a.AADObjectID, b.AADObjectID)
+	}
+	return a.Name != "" && a.Name == b.Name
+}
+
+// newConfirmationID returns a short random ID that's easy to type in a reply
+func newConfirmationID() (string, error) {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// describeEffect describes what executing the mutating command will do
+func describeEffect(command Command) string {
+	switch command.Verb {
+	case "scale":
+		replicas, _ := replicas(command)
+		return fmt.Sprintf("Scale deployment %s in namespace %s to %d replicas", command.Name, command.Namespace, replicas)
+	case "rollout":
+		if command.Subcommand == "restart" {
+			return fmt.Sprintf("Restart deployment %s in namespace %s", command.Name, command.Namespace)
+		}
+		revision, err := toRevision(command)
+		if err == nil && revision != 0 {
+			return fmt.Sprintf("Roll back deployment %s in namespace %s to revision %d", command.Name, command.Namespace, revision)
+		}
+		return fmt.Sprintf("Roll back deployment %s in namespace %s to the previous revision", command.Name, command.Namespace)
+	default:
+		return fmt.Sprintf("Delete %s %s in namespace %s", command.Resource, command.Name, command.Namespace)
+	}
+}
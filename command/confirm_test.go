@@ -0,0 +1,83 @@
+package command
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequiresConfirmation(t *testing.T) {
+	tests := []struct {
+		command  string
+		required bool
+	}{
+		{"get pods default", false},
+		{"delete pods default nginx", true},
+		{"delete certificates default example", true},
+		{"scale default nginx --replicas=0", true},
+		{"scale default nginx --replicas=3", false},
+		{"rollout undo default nginx", true},
+		{"rollout restart default nginx", false},
+		{"logs default nginx", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			if RequiresConfirmation(parsed) != test.required {
+				t.Errorf("expected confirmation required to be %t", test.required)
+			}
+		})
+	}
+}
+
+func TestTakePendingCommand(t *testing.T) {
+	parsed, err := parseCommand("delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+
+	pending, err := RequestConfirmation(sre, parsed, "delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to request confirmation: %v", err)
+	}
+	_, err = TakePendingCommand(junior, pending.ID)
+	if err == nil {
+		t.Fatalf("expected another user to be unable to confirm the command")
+	}
+	taken, err := TakePendingCommand(sre, pending.ID)
+	if err != nil {
+		t.Fatalf("expected the requester to be able to confirm the command: %v", err)
+	}
+	if taken.Command.Name != "nginx" {
+		t.Errorf("expected the pending command to be returned, got %v", taken.Command)
+	}
+	_, err = TakePendingCommand(sre, pending.ID)
+	if err == nil {
+		t.Fatalf("expected the command to only be confirmed once")
+	}
+}
+
+func TestTakePendingCommandExpired(t *testing.T) {
+	parsed, err := parseCommand("delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	pending, err := RequestConfirmation(sre, parsed, "delete pods default nginx")
+	if err != nil {
+		t.Fatalf("failed to request confirmation: %v", err)
+	}
+
+	originalNow := now
+	defer func() { now = originalNow }()
+	now = func() time.Time {
+		return pending.Expires
+	}
+
+	_, err = TakePendingCommand(sre, pending.ID)
+	if err == nil {
+		t.Fatalf("expected an expired command to be unable to be confirmed")
+	}
+}
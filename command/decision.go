@@ -0,0 +1,61 @@
+package command
+
+import (
+	"strings"
+)
+
+// Actions that a user can take on a pending command by replying to its card
+const (
+	ConfirmAction = "confirm"
+	CancelAction  = "cancel"
+	ApproveAction = "approve"
+	RejectAction  = "reject"
+)
+
+// DecisionActionKey and DecisionIDKey are the keys of the data sent back by the buttons on confirmation and approval cards
+const DecisionActionKey = "kontrolAction"
+const DecisionIDKey = "kontrolId"
+
+// Decision is the action a user took on the pending command with the given ID
+type Decision struct {
+	Action string
+	ID     string
+}
+
+// ParseDecision returns the decision if the text is a reply to a confirmation or approval card. i.e. confirm 1a2b3c4d
+func ParseDecision(text string) (Decision, bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return Decision{}, false
+	}
+	return decision(fields[0], fields[1])
+}
+
+// ParseDecisionValue returns the decision if the value is the data sent by a confirmation or approval card button
+func ParseDecisionValue(value interface{}) (Decision, bool) {
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		return Decision{}, false
+	}
+	action, _ := data[DecisionActionKey].(string)
+	id, _ := data[DecisionIDKey].(string)
+	return decision(action, id)
+}
+
+func decision(action string, id string) (Decision, bool) {
+	if id == "" {
+		return Decision{}, false
+	}
+	action = strings.ToLower(action)
+	switch action {
+	case ConfirmAction, CancelAction, ApproveAction, RejectAction:
+		return Decision{Action: action, ID: id}, true
+	default:
+		return Decision{}, false
+	}
+}
+
+// decisionData is the data sent back when a card button is clicked
+func decisionData(action string, id string) map[string]string {
+	return map[string]string{DecisionActionKey: action, DecisionIDKey: id}
+}
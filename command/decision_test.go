@@ -0,0 +1,43 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestParseDecision(t *testing.T) {
+	tests := []struct {
+		text     string
+		decision Decision
+		ok       bool
+	}{
+		{"confirm 1a2b3c4d", Decision{Action: ConfirmAction, ID: "1a2b3c4d"}, true},
+		{"Cancel 1a2b3c4d", Decision{Action: CancelAction, ID: "1a2b3c4d"}, true},
+		{"approve 1a2b3c4d", Decision{Action: ApproveAction, ID: "1a2b3c4d"}, true},
+		{"reject 1a2b3c4d", Decision{Action: RejectAction, ID: "1a2b3c4d"}, true},
+		{"confirm", Decision{}, false},
+		{"get pods default", Decision{}, false},
+		{"delete 1a2b3c4d", Decision{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			decision, ok := ParseDecision(test.text)
+			if ok != test.ok || decision != test.decision {
+				t.Errorf("expected %v %t, got %v %t", test.decision, test.ok, decision, ok)
+			}
+		})
+	}
+}
+
+func TestParseDecisionValue(t *testing.T) {
+	decision, ok := ParseDecisionValue(map[string]interface{}{
+		DecisionActionKey: "confirm",
+		DecisionIDKey:     "1a2b3c4d",
+	})
+	if !ok || decision != (Decision{Action: ConfirmAction, ID: "1a2b3c4d"}) {
+		t.Errorf("expected the card data to confirm 1a2b3c4d, got %v %t", decision, ok)
+	}
+	if _, ok := ParseDecisionValue(nil); ok {
+		t.Errorf("expected no decision without card data")
+	}
+}
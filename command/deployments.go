@@ -0,0 +1,52 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const replicasFlag = "replicas"
+const toRevisionFlag = "to-revision"
+
+func validateReplicas(value string) error {
+	replicas, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || replicas < 0 {
+		return errors.New("expected a number of replicas greater than or equal to 0")
+	}
+	return nil
+}
+
+// replicas returns the number of replicas given to the command with --replicas
+func replicas(command Command) (int32, error) {
+	value, ok := command.Flags[replicasFlag]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("--%s must be specified", replicasFlag))
+	}
+	replicas, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid value for --%s: %s", replicasFlag, value))
+	}
+	return int32(replicas), nil
+}
+
+func validateRevision(value string) error {
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || revision < 0 {
+		return errors.New("expected a revision greater than or equal to 0")
+	}
+	return nil
+}
+
+// toRevision returns the revision given to the command with --to-revision, 0 is returned if it wasn't given
+func toRevision(command Command) (int64, error) {
+	value, ok := command.Flags[toRevisionFlag]
+	if !ok {
+		return 0, nil
+	}
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid value for --%s: %s", toRevisionFlag, value))
+	}
+	return revision, nil
+}
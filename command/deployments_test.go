@@ -0,0 +1,149 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func simpleDeployment(name string, namespace string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			CreationTimestamp: goldenCreationTimestamp,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: name, Image: "nginx:1.17"}},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ReadyReplicas:     replicas - 1,
+			UpdatedReplicas:   replicas,
+			AvailableReplicas: replicas - 1,
+		},
+	}
+}
+
+func TestExecuteGetDeploymentsCommand(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		simpleDeployment("nginx", "nginx", 3),
+		simpleDeployment("nginx-canary", "nginx", 1),
+	)
+
+	command, err := ParseAndValidateCommandFromString(testRequester, "get deployments nginx")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	deploymentList, ok := result.(*appsv1.DeploymentList)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+	if len(deploymentList.Items) != 2 {
+		t.Fatalf("expected 2 deployments, instead got %d", len(deploymentList.Items))
+	}
+
+	assertGoldenCard(t, "deployment_list.json", deploymentListCard(deploymentList.Items))
+}
+
+func TestExecuteGetDeploymentCommand(t *testing.T) {
+	client := fake.NewSimpleClientset(simpleDeployment("nginx", "nginx", 3))
+
+	command, err := ParseAndValidateCommandFromString(testRequester, "get deployments nginx nginx")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	deployment, ok := result.(*appsv1.Deployment)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+
+	assertGoldenCard(t, "deployment.json", deploymentCard(deployment))
+}
+
+func TestExecuteScaleCommand(t *testing.T) {
+	client := fake.NewSimpleClientset(simpleDeployment("nginx", "nginx", 3))
+
+	command, err := ParseAndValidateCommandFromString(testRequester, "scale nginx nginx --replicas=5")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	if command.Resource != "deployments" {
+		t.Fatalf("expected scale to imply the deployments resource, instead got %s", command.Resource)
+	}
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	scale, ok := result.(*k8s.DeploymentScale)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+	if scale.PreviousReplicas != 3 || *scale.Deployment.Spec.Replicas != 5 {
+		t.Fatalf("expected deployment to be scaled from 3 to 5 replicas, instead got %d to %d",
+			scale.PreviousReplicas, *scale.Deployment.Spec.Replicas)
+	}
+
+	assertGoldenCard(t, "deployment_scale.json", deploymentScaleCard(scale))
+}
+
+func TestExecuteRolloutRestartCommand(t *testing.T) {
+	client := fake.NewSimpleClientset(simpleDeployment("nginx", "nginx", 3))
+
+	command, err := ParseAndValidateCommandFromString(testRequester, "rollout restart nginx nginx")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	restart, ok := result.(*k8s.DeploymentRestart)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+	restartedAt := restart.Deployment.Spec.Template.Annotations[k8s.RestartedAtAnnotation]
+	if restartedAt != restart.RestartedAt.Format(time.RFC3339) {
+		t.Fatalf("expected pod template to be annotated with %s, instead got '%s'", k8s.RestartedAtAnnotation, restartedAt)
+	}
+
+	restart.RestartedAt = goldenCreationTimestamp.Add(time.Hour)
+	assertGoldenCard(t, "deployment_restart.json", deploymentRestartCard(restart))
+}
+
+func TestParseAndValidateDeploymentCommandsInvalid(t *testing.T) {
+	invalidCommands := []string{
+		"scale nginx nginx",               // missing --replicas
+		"scale nginx nginx --replicas=-1", // negative replicas
+		"rollout nginx nginx",             // missing subcommand
+		"rollout pause nginx nginx",       // unknown subcommand
+		"rollout restart nginx",           // missing name
+	}
+
+	for _, invalidCommand := range invalidCommands {
+		_, err := ParseAndValidateCommandFromString(testRequester, invalidCommand)
+		if err == nil {
+			t.Errorf("expected command to be invalid: %s", invalidCommand)
+		}
+	}
+}
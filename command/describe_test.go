@@ -0,0 +1,100 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func describedPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "nginx-1",
+			Namespace:         "nginx",
+			CreationTimestamp: goldenCreationTimestamp,
+		},
+		Spec: v1.PodSpec{
+			NodeName: "kind-worker",
+			Containers: []v1.Container{
+				{Name: "controller", Image: "quay.io/kubernetes-ingress-controller/nginx-ingress-controller:0.25.0"},
+				{Name: "sidecar", Image: "busybox:1.31"},
+			},
+		},
+		Status: v1.PodStatus{
+			Phase:  v1.PodRunning,
+			PodIP:  "10.244.1.5",
+			HostIP: "172.17.0.3",
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionFalse},
+				{Type: v1.PodScheduled, Status: v1.ConditionTrue},
+			},
+			ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name:         "controller",
+					Ready:        true,
+					RestartCount: 0,
+					State:        v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				},
+				{
+					Name:         "sidecar",
+					RestartCount: 4,
+					State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				},
+			},
+		},
+	}
+}
+
+func podEvent(name string, reason string, message string, lastSeen time.Time) *v1.Event {
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "nginx",
+		},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "nginx-1", Namespace: "nginx"},
+		Type:           v1.EventTypeWarning,
+		Reason:         reason,
+		Message:        message,
+		LastTimestamp:  metav1.NewTime(lastSeen),
+	}
+}
+
+func TestExecuteDescribePodCommand(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		describedPod(),
+		podEvent("nginx-1.1", "Pulled", "Container image \"busybox:1.31\" already present on machine", goldenCreationTimestamp.Add(time.Minute)),
+		podEvent("nginx-1.2", "BackOff", "Back-off restarting failed container", goldenCreationTimestamp.Add(time.Hour)),
+	)
+
+	command, err := ParseAndValidateCommandFromString(testRequester, "describe pods nginx nginx-1")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	description, ok := result.(*k8s.PodDescription)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+	if description.Pod.Name != "nginx-1" {
+		t.Fatalf("expected pod nginx-1 to be described, instead got %s", description.Pod.Name)
+	}
+	if len(description.Events) != 2 || description.Events[0].Reason != "BackOff" {
+		t.Fatalf("expected events to be sorted with the most recent first, instead got %v", description.Events)
+	}
+
+	assertGoldenCard(t, "pod_describe.json", podDescriptionCard(description))
+}
+
+func TestParseAndValidateDescribeWithoutName(t *testing.T) {
+	_, err := ParseAndValidateCommandFromString(testRequester, "describe pods nginx")
+	if err == nil {
+		t.Fatalf("expected describe without a name to be invalid")
+	}
+}
@@ -0,0 +1,184 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func certificate(name string, ready string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "cert-manager.io/v1alpha2",
+			"kind":       "Certificate",
+			"metadata": map[string]interface{}{
+				"name":              name,
+				"namespace":         "nginx",
+				"creationTimestamp": goldenCreationTimestamp.Format("2006-01-02T15:04:05Z"),
+			},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Ready", "status": ready, "reason": "Pending"},
+				},
+			},
+		},
+	}
+}
+
+// dynamicClients returns clients with core, apps and cert-manager resources available through discovery and two certificates
+func dynamicClients() k8s.Clients {
+	client := fake.NewSimpleClientset()
+	client.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", SingularName: "pod", Namespaced: true, Kind: "Pod", ShortNames: []string{"po"}},
+				{Name: "secrets", SingularName: "secret", Namespaced: true, Kind: "Secret"},
+				{Name: "configmaps", SingularName: "configmap", Namespaced: true, Kind: "ConfigMap", ShortNames: []string{"cm"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", SingularName: "deployment", Namespaced: true, Kind: "Deployment", ShortNames: []string{"deploy"}},
+			},
+		},
+		{
+			GroupVersion: "cert-manager.io/v1alpha2",
+			APIResources: []metav1.APIResource{
+				{Name: "certificates", SingularName: "certificate", Namespaced: true, Kind: "Certificate", ShortNames: []string{"cert", "certs"}},
+				{Name: "clusterissuers", SingularName: "clusterissuer", Namespaced: false, Kind: "ClusterIssuer"},
+			},
+		},
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		certificate("nginx-tls", "True"),
+		certificate("nginx-canary-tls", "False"),
+	)
+	return k8s.Clients{Kubernetes: client, Dynamic: dynamicClient}
+}
+
+func TestExecuteGetResourcesCommand(t *testing.T) {
+	for _, commandStr := range []string{"get certificates nginx", "get cert nginx", "get certificates.cert-manager.io nginx"} {
+		t.Run(commandStr, func(t *testing.T) {
+			command, err := ParseAndValidateCommandFromString(testRequester, commandStr)
+			if err != nil {
+				t.Fatalf("failed to parse and validate command: %v", err)
+			}
+			result, err := ExecuteCommand(dynamicClients(), command)
+			if err != nil {
+				t.Fatalf("failed to execute command: %v", err)
+			}
+
+			list, ok := result.(*unstructured.UnstructuredList)
+			if !ok {
+				t.Fatalf("got unexpected result type: %T", result)
+			}
+			if len(list.Items) != 2 {
+				t.Fatalf("expected 2 certificates, instead got %d", len(list.Items))
+			}
+		})
+	}
+}
+
+func TestExecuteGetResourceCommand(t *testing.T) {
+	command, err := ParseAndValidateCommandFromString(testRequester, "get certificates nginx nginx-canary-tls")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(dynamicClients(), command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	resource, ok := result.(*unstructured.Unstructured)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+
+	assertGoldenCard(t, "resource.json", resourceCard(resource))
+}
+
+func TestResourceListCardGolden(t *testing.T) {
+	resources := []unstructured.Unstructured{
+		*certificate("nginx-tls", "True"),
+		*certificate("nginx-canary-tls", "False"),
+	}
+	assertGoldenCard(t, "resource_list.json", resourceListCard(resources))
+}
+
+func TestExecuteDeleteResourceCommand(t *testing.T) {
+	clients := dynamicClients()
+
+	command, err := ParseAndValidateCommandFromString(testRequester, "delete cert nginx nginx-tls")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	_, err = ExecuteCommand(clients, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	command, err = ParseAndValidateCommandFromString(testRequester, "get certificates nginx")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(clients, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+	if items := result.(*unstructured.UnstructuredList).Items; len(items) != 1 || items[0].GetName() != "nginx-canary-tls" {
+		t.Fatalf("expected only nginx-canary-tls to remain, instead got %v", items)
+	}
+}
+
+func TestExecuteUnsupportedResourceCommand(t *testing.T) {
+	for _, commandStr := range []string{"get clusterissuers nginx", "get widgets nginx"} {
+		t.Run(commandStr, func(t *testing.T) {
+			_, err := ParseAndValidateCommandFromString(testRequester, commandStr)
+			if err == nil {
+				t.Fatalf("expected command to be rejected for a cluster scoped or unknown resource")
+			}
+		})
+	}
+}
+
+func TestResolveResourceCachesDiscovery(t *testing.T) {
+	clients := dynamicClients()
+	client := clients.Kubernetes.(*fake.Clientset)
+	clients.Mapper = k8s.NewMapper(client.Discovery())
+
+	_, err := k8s.ResolveResource(clients, "cert")
+	if err != nil {
+		t.Fatalf("failed to resolve resource: %v", err)
+	}
+	discoveryCalls := len(client.Actions())
+	if discoveryCalls == 0 {
+		t.Fatal("expected the first resolution to run discovery")
+	}
+	for _, resource := range []string{"certificates", "certificate", "certificates.cert-manager.io"} {
+		_, err = k8s.ResolveResource(clients, resource)
+		if err != nil {
+			t.Fatalf("failed to resolve resource %s: %v", resource, err)
+		}
+	}
+	if len(client.Actions()) != discoveryCalls {
+		t.Errorf("expected discovery to be cached, instead got %d more calls", len(client.Actions())-discoveryCalls)
+	}
+
+	// resources installed after discovery was cached are found by refreshing it
+	client.Resources[0].APIResources = append(client.Resources[0].APIResources,
+		metav1.APIResource{Name: "issuers", SingularName: "issuer", Namespaced: true, Kind: "Issuer"})
+	mapping, err := k8s.ResolveResource(clients, "issuers")
+	if err != nil {
+		t.Fatalf("expected discovery to be refreshed for an unknown resource: %v", err)
+	}
+	if mapping.GroupVersionKind.Kind != "Issuer" {
+		t.Errorf("expected Issuer, instead got %s", mapping.GroupVersionKind.Kind)
+	}
+}
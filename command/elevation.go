@@ -0,0 +1,226 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/audit"
+	"github.com/daniel-cole/teams-kontrol/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+const elevateVerb = "elevate"
+
+// ElevationRequest asks for a role to be granted to the requester for a limited time
+type ElevationRequest struct {
+	Role     string        `json:"role"`
+	Duration time.Duration `json:"duration"`
+	Reason   string        `json:"reason"`
+}
+
+// Elevation is an elevated role granted to a user until it expires
+type Elevation struct {
+	ID        string      `json:"id"`
+	Role      string      `json:"role"`
+	Reason    string      `json:"reason"`
+	Requester Requester   `json:"requester"`
+	Approver  *Requester  `json:"approver,omitempty"`
+	Granted   time.Time   `json:"granted"`
+	Expires   time.Time   `json:"expires"`
+	Rule      config.Rule `json:"-"`
+}
+
+var elevations = struct {
+	sync.Mutex
+	active map[string]*Elevation
+}{active: map[string]*Elevation{}}
+
+// ParseElevation returns the elevation request if the text is an elevate command. i.e. elevate incident 30m "database is down"
+// a *ParseError is returned if the text is an elevate command that can't be parsed
+func ParseElevation(text string) (ElevationRequest, bool, error) {
+	tokens, err := tokenize(text)
+	if err != nil || len(tokens) == 0 || !strings.EqualFold(tokens[0].value, elevateVerb) {
+		return ElevationRequest{}, false, nil
+	}
+
+	end := len([]rune(text)) + 1
+	usage := "expected: elevate <role> <duration> <reason>"
+	if len(tokens) < 4 {
+		return ElevationRequest{}, true, &ParseError{Position: end, Message: "missing role, duration or reason, " + usage}
+	}
+	duration, err := time.ParseDuration(tokens[2].value)
+	if err != nil || duration <= 0 {
+		return ElevationRequest{}, true, &ParseError{Position: tokens[2].pos, Message: "invalid duration, " + usage}
+	}
+	var reason []string
+	for _, t := range tokens[3:] {
+		reason = append(reason, t.value)
+	}
+	return ElevationRequest{
+		Role:     tokens[1].value,
+		Duration: duration,
+		Reason:   strings.Join(reason, " "),
+	}, true, nil
+}
+
+// Elevate grants the role to the requester, or returns an *ApprovalRequest when the role must be approved first.
+// The requester must be able to elevate to the role and the duration can't exceed the role's maximum.
+func Elevate(requester Requester, request ElevationRequest, text string) (interface{}, error) {
+	role, err := elevatedRoleFor(requester, request)
+	if err != nil {
+		auditElevation(audit.DecisionDenied, "", requester, nil, request, err)
+		return nil, err
+	}
+
+	if role.RequireApproval {
+		id, err := newConfirmationID()
+		if err != nil {
+			return nil, err
+		}
+		approval := &ApprovalRequest{
+			ID:          id,
+			Text:        text,
+			Requester:   requester,
+			RequestedAt: now(),
+			Expires:     now().Add(approvalTimeout()),
+			Elevation:   &request,
+		}
+		err = approvals.Save(approval)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failed to save approval request: %v", err))
+		}
+		auditElevation(audit.DecisionApprovalRequired, approval.ID, requester, nil, request, nil)
+		return approval, nil
+	}
+
+	return grantElevation(requester, nil, request, role)
+}
+
+// elevatedRoleFor returns the role if the requester can elevate to it for the requested duration
+func elevatedRoleFor(requester Requester, request ElevationRequest) (config.ElevatedRole, error) {
+	role, ok := currentPermissions().Elevation.Role(request.Role)
+	if !ok || !ruleAppliesTo(role.Rule, requester) {
+		return config.ElevatedRole{}, errors.New(fmt.Sprintf("permission error - %s can't elevate to role %s", requesterName(requester), request.Role))
+	}
+	if request.Duration > role.MaxDuration {
+		return config.ElevatedRole{}, errors.New(fmt.Sprintf("permission error - role %s can be granted for at most %s", role.Name, role.MaxDuration))
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		return config.ElevatedRole{}, errors.New("a reason is required to elevate")
+	}
+	return role, nil
+}
+
+// approveElevation grants the elevation once one of the role's approvers approves it
+func approveElevation(approver Requester, approval *ApprovalRequest) (*Elevation, error) {
+	request := *approval.Elevation
+	role, err := elevatedRoleFor(approval.Requester, request)
+	if err != nil {
+		return nil, err
+	}
+	if !canApproveElevation(approver, role) {
+		return nil, errors.New(fmt.Sprintf("%s isn't an approver of role %s", requesterName(approver), role.Name))
+	}
+	err = takeApproval(approval.ID)
+	if err != nil {
+		return nil, err
+	}
+	return grantElevation(approval.Requester, &approver, request, role)
+}
+
+// canApproveElevation returns whether the user is one of the role's approvers
+func canApproveElevation(approver Requester, role config.ElevatedRole) bool {
+	for _, subject := range role.Approvers {
+		if subject.Matches(approver.AADObjectID, approver.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantElevation adds the role's rule for the requester until the elevation expires and schedules its revocation
+func grantElevation(requester Requester, approver *Requester, request ElevationRequest, role config.ElevatedRole) (*Elevation, error) {
+	id, err := newConfirmationID()
+	if err != nil {
+		return nil, err
+	}
+
+	rule := role.Rule
+	rule.Subjects = []config.Subject{{AADObjectID: requester.AADObjectID, Name: requester.Name}}
+	elevation := &Elevation{
+		ID:        id,
+		Role:      role.Name,
+		Reason:    request.Reason,
+		Requester: requester,
+		Approver:  approver,
+		Granted:   now(),
+		Expires:   now().Add(request.Duration),
+		Rule:      rule,
+	}
+
+	elevations.Lock()
+	elevations.active[id] = elevation
+	elevations.Unlock()
+	time.AfterFunc(request.Duration, func() {
+		revokeElevation(id)
+	})
+
+	auditElevation(audit.DecisionGranted, id, requester, approver, request, nil)
+	return elevation, nil
+}
+
+// revokeElevation removes the elevation once it has expired
+func revokeElevation(id string) {
+	elevations.Lock()
+	elevation, ok := elevations.active[id]
+	delete(elevations.active, id)
+	elevations.Unlock()
+
+	if ok {
+		auditElevation(audit.DecisionRevoked, id, elevation.Requester, elevation.Approver, ElevationRequest{Role: elevation.Role, Reason: elevation.Reason}, nil)
+	}
+}
+
+// effectivePermissions returns the permissions including the rules granted by active elevations.
+// Elevations are also filtered by their expiry so that they never outlive it if revoking them is delayed.
+func effectivePermissions() config.Permissions {
+	p := currentPermissions()
+
+	elevations.Lock()
+	defer elevations.Unlock()
+	if len(elevations.active) == 0 {
+		return p
+	}
+	rules := append([]config.Rule{}, p.Rules...)
+	current := now()
+	for _, elevation := range elevations.active {
+		if current.Before(elevation.Expires) {
+			rules = append(rules, elevation.Rule)
+		}
+	}
+	p.Rules = rules
+	return p
+}
+
+// auditElevation records a change to an elevation as an audit event, approver is nil unless the elevation was approved
+func auditElevation(decision string, id string, requester Requester, approver *Requester, request ElevationRequest, err error) {
+	event := audit.NewEvent(context.Background(), audit.ElevationEvent)
+	event.User = requesterName(requester)
+	event.AADObjectID = requester.AADObjectID
+	event.TeamID = requester.TeamID
+	event.ChannelID = requester.ChannelID
+	if approver != nil {
+		event.Approver = requesterName(*approver)
+	}
+	event.ID = id
+	event.Command = request
+	event.Decide(decision, err)
+	audit.Record(event)
+}
+
+// describeElevation describes the access an elevation grants. i.e. grant role incident for 30m
+func describeElevation(request ElevationRequest) string {
+	return fmt.Sprintf("grant role %s for %s", request.Role, request.Duration)
+}
@@ -0,0 +1,220 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/audit"
+	"testing"
+	"time"
+)
+
+const elevationPermissions = `
+verbs:
+  - "get"
+resources:
+  - "pods"
+namespaces:
+  - "default"
+elevation:
+  roles:
+    - name: "incident"
+      maxDuration: "1h"
+      subjects:
+        - name: "Test User"
+      verbs:
+        - "delete"
+      resources:
+        - "pods"
+      namespaces:
+        - "default"
+    - name: "admin"
+      maxDuration: "30m"
+      requireApproval: true
+      subjects:
+        - name: "Test User"
+      approvers:
+        - name: "Some SRE"
+      verbs:
+        - "*"
+      resources:
+        - "*"
+      namespaces:
+        - "*"
+`
+
+// useTestElevations clears the active elevations and returns a function that clears them again
+func useTestElevations() func() {
+	clear := func() {
+		elevations.Lock()
+		elevations.active = map[string]*Elevation{}
+		elevations.Unlock()
+	}
+	clear()
+	return clear
+}
+
+// recordingSink keeps the audit events written to it
+type recordingSink struct {
+	events []*audit.Event
+}
+
+func (s *recordingSink) Write(event *audit.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestParseElevation(t *testing.T) {
+	tests := []struct {
+		text      string
+		elevation bool
+		expected  ElevationRequest
+		err       bool
+	}{
+		{"get pods default", false, ElevationRequest{}, false},
+		{`elevate incident 30m "database is down"`, true, ElevationRequest{Role: "incident", Duration: 30 * time.Minute, Reason: "database is down"}, false},
+		{"elevate incident 1h database is down", true, ElevationRequest{Role: "incident", Duration: time.Hour, Reason: "database is down"}, false},
+		{"elevate incident 30m", true, ElevationRequest{}, true},
+		{"elevate incident soon database is down", true, ElevationRequest{}, true},
+		{"elevate incident -5m database is down", true, ElevationRequest{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			request, ok, err := ParseElevation(test.text)
+			if ok != test.elevation {
+				t.Fatalf("expected elevation to be %t", test.elevation)
+			}
+			if test.err {
+				if _, isParseErr := err.(*ParseError); !isParseErr {
+					t.Fatalf("expected a parse error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse elevation: %v", err)
+			}
+			if request != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, request)
+			}
+		})
+	}
+}
+
+func TestElevate(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, elevationPermissions))()
+	defer useTestElevations()()
+
+	_, err := ParseAndValidateCommandFromString(testRequester, "delete pods default nginx")
+	if err == nil {
+		t.Fatal("expected delete to be denied before elevating")
+	}
+
+	_, err = Elevate(testRequester, ElevationRequest{Role: "incident", Duration: 2 * time.Hour, Reason: "outage"}, "")
+	if err == nil {
+		t.Error("expected elevation longer than the role's max duration to be denied")
+	}
+	_, err = Elevate(sre, ElevationRequest{Role: "incident", Duration: time.Hour, Reason: "outage"}, "")
+	if err == nil {
+		t.Error("expected elevation by a user who isn't a subject of the role to be denied")
+	}
+	_, err = Elevate(testRequester, ElevationRequest{Role: "unknown", Duration: time.Hour, Reason: "outage"}, "")
+	if err == nil {
+		t.Error("expected elevation to an unknown role to be denied")
+	}
+
+	result, err := Elevate(testRequester, ElevationRequest{Role: "incident", Duration: time.Hour, Reason: "outage"}, "")
+	if err != nil {
+		t.Fatalf("failed to elevate: %v", err)
+	}
+	elevation, ok := result.(*Elevation)
+	if !ok {
+		t.Fatalf("expected elevation to be granted, got %T", result)
+	}
+
+	_, err = ParseAndValidateCommandFromString(testRequester, "delete pods default nginx")
+	if err != nil {
+		t.Errorf("expected delete to be permitted after elevating: %v", err)
+	}
+	_, err = ParseAndValidateCommandFromString(sre, "delete pods default nginx")
+	if err == nil {
+		t.Error("expected elevation to only apply to the requester")
+	}
+
+	revokeElevation(elevation.ID)
+	_, err = ParseAndValidateCommandFromString(testRequester, "delete pods default nginx")
+	if err == nil {
+		t.Error("expected delete to be denied after the elevation is revoked")
+	}
+}
+
+func TestElevationExpires(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, elevationPermissions))()
+	defer useTestElevations()()
+
+	_, err := Elevate(testRequester, ElevationRequest{Role: "incident", Duration: 50 * time.Millisecond, Reason: "outage"}, "")
+	if err != nil {
+		t.Fatalf("failed to elevate: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	elevations.Lock()
+	active := len(elevations.active)
+	elevations.Unlock()
+	if active != 0 {
+		t.Errorf("expected elevation to be revoked when it expires, %d still active", active)
+	}
+}
+
+func TestApproveElevation(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, elevationPermissions))()
+	defer useTestElevations()()
+	defer useTestApprovalStore(newMemoryApprovalStore())()
+	sink := &recordingSink{}
+	audit.SetSinks(sink)
+	defer func() { _ = audit.Init() }()
+
+	request := ElevationRequest{Role: "admin", Duration: 30 * time.Minute, Reason: "restore backups"}
+	result, err := Elevate(testRequester, request, `elevate admin 30m "restore backups"`)
+	if err != nil {
+		t.Fatalf("failed to request elevation: %v", err)
+	}
+	approval, ok := result.(*ApprovalRequest)
+	if !ok {
+		t.Fatalf("expected elevation to require approval, got %T", result)
+	}
+
+	_, _, err = Approve(testRequester, approval.ID, nil)
+	if err == nil {
+		t.Error("expected requester to be unable to approve their own elevation")
+	}
+	_, _, err = Approve(sreByName, approval.ID, nil)
+	if err == nil {
+		t.Error("expected a user who isn't an approver of the role to be unable to approve")
+	}
+	_, err = Reject(sreByName, approval.ID)
+	if err == nil {
+		t.Error("expected a user who isn't an approver of the role to be unable to reject")
+	}
+	_, err = ParseAndValidateCommandFromString(testRequester, "delete deployments prod nginx")
+	if err == nil {
+		t.Fatal("expected delete to be denied before the elevation is approved")
+	}
+
+	approved, _, err := Approve(sre, approval.ID, nil)
+	if err != nil {
+		t.Fatalf("failed to approve elevation: %v", err)
+	}
+	if approved.Approver == nil || approved.Approver.Name != sre.Name {
+		t.Errorf("expected approver to be recorded, got %+v", approved.Approver)
+	}
+	granted := sink.events[len(sink.events)-1]
+	if granted.Type != audit.ElevationEvent || granted.Decision != audit.DecisionGranted || granted.Approver != sre.Name {
+		t.Errorf("expected the granted elevation to be audited with its approver, got %+v", granted)
+	}
+	_, err = ParseAndValidateCommandFromString(testRequester, "delete deployments prod nginx")
+	if err != nil {
+		t.Errorf("expected delete to be permitted after the elevation is approved: %v", err)
+	}
+	_, _, err = Approve(sre, approval.ID, nil)
+	if err == nil {
+		t.Error("expected elevation to only be approved once")
+	}
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+)
+
+// impersonatedClients creates the clients for an impersonated user, it's replaced in tests
+var impersonatedClients = k8s.ImpersonatedClients
+
+// ClientsFor returns the clients that commands from the requester are executed with.
+// The given clients are returned unless impersonation is enabled, in which case the requester must be
+// mapped to a kubernetes user and the returned clients impersonate that user.
+func ClientsFor(clients k8s.Clients, requester Requester) (k8s.Clients, error) {
+	impersonation := currentPermissions().Impersonation
+	if !impersonation.Enabled {
+		return clients, nil
+	}
+	user, ok := impersonation.UserFor(requester.AADObjectID, requester.Name)
+	if !ok {
+		return k8s.Clients{}, errors.New(fmt.Sprintf("permission error - %s is not mapped to a kubernetes user", requesterName(requester)))
+	}
+	return impersonatedClients(user.Username, user.Groups)
+}
+
+// requesterName returns a name that identifies the requester in messages
+func requesterName(requester Requester) string {
+	switch {
+	case requester.Name != "":
+		return requester.Name
+	case requester.AADObjectID != "":
+		return requester.AADObjectID
+	default:
+		return "anonymous requester"
+	}
+}
@@ -0,0 +1,119 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/config"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const impersonationPermissions = `
+verbs:
+  - "get"
+resources:
+  - "pods"
+namespaces:
+  - "default"
+impersonation:
+  enabled: true
+  users:
+    - name: "Jane SRE"
+      username: "jane-by-name@example.com"
+    - aadObjectId: "6a1f1b3c-2d4e-4f50-8a6b-7c8d9e0f1a2b"
+      username: "jane@example.com"
+      groups:
+        - "sre"
+`
+
+// useTestPermissions swaps in the permissions and returns a function that restores the original permissions
+func useTestPermissions(p config.Permissions) func() {
+	original := currentPermissions()
+	permissions.Store(p)
+	return func() {
+		permissions.Store(original)
+	}
+}
+
+func TestClientsForImpersonation(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, impersonationPermissions))()
+
+	// requests made with the impersonated clients are sent to a test server to check the impersonation headers
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"Pod","apiVersion":"v1","metadata":{"name":"nginx","namespace":"default"}}`))
+	}))
+	defer server.Close()
+	originalConfig := k8s.Config
+	k8s.Config = &rest.Config{Host: server.URL}
+	defer func() { k8s.Config = originalConfig }()
+
+	clients, err := ClientsFor(k8s.Clients{}, sre)
+	if err != nil {
+		t.Fatalf("failed to get clients: %v", err)
+	}
+	_, err = k8s.GetPod(clients.Kubernetes, "default", "nginx")
+	if err != nil {
+		t.Fatalf("failed to get pod: %v", err)
+	}
+	if user := headers.Get("Impersonate-User"); user != "jane@example.com" {
+		t.Errorf("expected to impersonate jane@example.com, got %s", user)
+	}
+	if groups := headers["Impersonate-Group"]; !reflect.DeepEqual(groups, []string{"sre"}) {
+		t.Errorf("expected to impersonate the sre group, got %v", groups)
+	}
+}
+
+func TestClientsForMapping(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, impersonationPermissions))()
+
+	var username string
+	original := impersonatedClients
+	impersonatedClients = func(user string, groups []string) (k8s.Clients, error) {
+		username = user
+		return k8s.Clients{}, nil
+	}
+	defer func() { impersonatedClients = original }()
+
+	tests := []struct {
+		requester Requester
+		username  string
+	}{
+		{sre, "jane@example.com"},
+		{Requester{AADObjectID: "6a1f1b3c-2d4e-4f50-8a6b-7c8d9e0f1a2b", Name: "Jane SRE"}, "jane@example.com"},
+		{sreByName, "jane-by-name@example.com"},
+		{junior, ""},
+		{Requester{}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.requester.Name, func(t *testing.T) {
+			username = ""
+			_, err := ClientsFor(k8s.Clients{}, test.requester)
+			if test.username == "" && err == nil {
+				t.Fatalf("expected requester without a mapping to be rejected")
+			}
+			if test.username != "" && err != nil {
+				t.Fatalf("failed to get clients: %v", err)
+			}
+			if username != test.username {
+				t.Errorf("expected to impersonate %s, got %s", test.username, username)
+			}
+		})
+	}
+}
+
+func TestClientsForImpersonationDisabled(t *testing.T) {
+	clients := dynamicClients()
+	got, err := ClientsFor(clients, junior)
+	if err != nil {
+		t.Fatalf("failed to get clients: %v", err)
+	}
+	if got != clients {
+		t.Errorf("expected the given clients to be used when impersonation is disabled")
+	}
+}
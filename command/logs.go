@@ -0,0 +1,92 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"strconv"
+	"time"
+)
+
+const containerFlag = "container"
+const tailFlag = "tail"
+const sinceFlag = "since"
+const previousFlag = "previous"
+
+// defaultTailLines limits the logs retrieved when --tail isn't specified as only the end of the logs will fit in a message
+const defaultTailLines = 100
+
+// maxTailLines is the most lines that can be retrieved with --tail, far more than will fit in a message
+const maxTailLines = 1000
+
+// maxLogBytes is the most log output that will be sent in a card, teams rejects messages larger than ~28KB
+const maxLogBytes = 16 * 1024
+
+// maxLogFetchBytes limits the log output the API server returns so that a noisy container can't exhaust memory.
+// It's larger than maxLogBytes so that the logs are usually truncated to their end rather than by the API server,
+// which keeps the start of the output.
+const maxLogFetchBytes = 4 * maxLogBytes
+
+func validateTail(value string) error {
+	lines, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || lines < 1 || lines > maxTailLines {
+		return errors.New(fmt.Sprintf("expected a number of lines between 1 and %d", maxTailLines))
+	}
+	return nil
+}
+
+func validateSince(value string) error {
+	since, err := time.ParseDuration(value)
+	if err != nil || since <= 0 {
+		return errors.New("expected a positive duration, i.e. 5m or 1h")
+	}
+	return nil
+}
+
+// podLogOptions returns the log options for the flags given to the command
+// flags are expected to have already been validated when the command was parsed
+func podLogOptions(command Command) (*v1.PodLogOptions, error) {
+	limitBytes := int64(maxLogFetchBytes)
+	opts := &v1.PodLogOptions{
+		Container:  command.Flags[containerFlag],
+		Previous:   command.Flags[previousFlag] == "true",
+		LimitBytes: &limitBytes,
+	}
+
+	tailLines := int64(defaultTailLines)
+	if tail, ok := command.Flags[tailFlag]; ok {
+		var err error
+		tailLines, err = strconv.ParseInt(tail, 10, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid value for --%s: %s", tailFlag, tail))
+		}
+	}
+	opts.TailLines = &tailLines
+
+	if since, ok := command.Flags[sinceFlag]; ok {
+		duration, err := time.ParseDuration(since)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid value for --%s: %s", sinceFlag, since))
+		}
+		sinceSeconds := int64(duration.Seconds())
+		opts.SinceSeconds = &sinceSeconds
+	}
+
+	return opts, nil
+}
+
+// truncateLogs keeps the end of the logs so that they fit in a message
+// the returned bool indicates whether the logs were truncated
+func truncateLogs(logs string, maxBytes int) (string, bool) {
+	if len(logs) <= maxBytes {
+		return logs, false
+	}
+	logs = logs[len(logs)-maxBytes:]
+	// start from the next full line rather than part way through one
+	for i := 0; i < len(logs); i++ {
+		if logs[i] == '\n' {
+			return logs[i+1:], true
+		}
+	}
+	return logs, true
+}
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	"strings"
+	"testing"
+)
+
+func TestParseAndValidateLogsCommand(t *testing.T) {
+	command, err := ParseAndValidateCommandFromString(testRequester, "logs nginx nginx-1 -c controller --tail 20 --since=1h -p")
+	if err != nil {
+		t.Fatalf("expected command to be valid: %v", err)
+	}
+	if command.Resource != "pods" || command.Namespace != "nginx" || command.Name != "nginx-1" {
+		t.Fatalf("unexpected command: %+v", command)
+	}
+
+	opts, err := podLogOptions(command)
+	if err != nil {
+		t.Fatalf("failed to create pod log options: %v", err)
+	}
+	if opts.Container != "controller" {
+		t.Errorf("expected container to be controller, instead got %s", opts.Container)
+	}
+	if opts.TailLines == nil || *opts.TailLines != 20 {
+		t.Errorf("expected tail lines to be 20, instead got %v", opts.TailLines)
+	}
+	if opts.SinceSeconds == nil || *opts.SinceSeconds != 3600 {
+		t.Errorf("expected since seconds to be 3600, instead got %v", opts.SinceSeconds)
+	}
+	if !opts.Previous {
+		t.Errorf("expected previous to be true")
+	}
+}
+
+func TestPodLogOptionsDefaultTail(t *testing.T) {
+	command, err := ParseAndValidateCommandFromString(testRequester, "logs nginx nginx-1")
+	if err != nil {
+		t.Fatalf("expected command to be valid: %v", err)
+	}
+	opts, err := podLogOptions(command)
+	if err != nil {
+		t.Fatalf("failed to create pod log options: %v", err)
+	}
+	if opts.TailLines == nil || *opts.TailLines != defaultTailLines {
+		t.Fatalf("expected tail lines to default to %d, instead got %v", defaultTailLines, opts.TailLines)
+	}
+	if opts.LimitBytes == nil || *opts.LimitBytes != maxLogFetchBytes {
+		t.Errorf("expected the logs to be limited to %d bytes, instead got %v", maxLogFetchBytes, opts.LimitBytes)
+	}
+}
+
+func TestTruncateLogs(t *testing.T) {
+	logs := "first line\nsecond line\nthird line\n"
+
+	truncated, ok := truncateLogs(logs, len(logs))
+	if ok || truncated != logs {
+		t.Fatalf("expected logs not to be truncated, got '%s'", truncated)
+	}
+
+	truncated, ok = truncateLogs(logs, 15)
+	if !ok {
+		t.Fatalf("expected logs to be truncated")
+	}
+	if truncated != "third line\n" {
+		t.Fatalf("expected logs to be truncated to the last full line, got '%s'", truncated)
+	}
+}
+
+func TestPodLogsCardGolden(t *testing.T) {
+	podLogs := &k8s.PodLogs{
+		Namespace: "nginx",
+		Name:      "nginx-1",
+		Container: "controller",
+		Logs:      "I0318 02:08:55.000000       1 main.go:1] \"starting\" <controller>\n\tat backslash \\ line\n",
+	}
+	assertGoldenCard(t, "pod_logs.json", podLogsCard(podLogs))
+}
+
+func TestPodLogsCardTruncated(t *testing.T) {
+	podLogs := &k8s.PodLogs{
+		Namespace: "nginx",
+		Name:      "nginx-1",
+		Logs:      strings.Repeat("log line\n", maxLogBytes),
+	}
+	out, err := renderCard(podLogsCard(podLogs))
+	if err != nil {
+		t.Fatalf("failed to render card: %v", err)
+	}
+	if len(out) > 2*maxLogBytes {
+		t.Fatalf("expected card to be truncated, instead got %d bytes", len(out))
+	}
+}
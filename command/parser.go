@@ -0,0 +1,362 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// flagSpec describes a flag that can be given to a command
+type flagSpec struct {
+	name     string
+	short    string
+	boolean  bool                     // boolean flags don't consume the next token as their value
+	validate func(value string) error // optional syntax check of the value
+}
+
+var flagSpecs = []flagSpec{
+	{name: labelSelectorFlag, short: "l", validate: validateLabelSelector},
+	{name: fieldSelectorFlag, validate: validateFieldSelector},
+	{name: containerFlag, short: "c"},
+	{name: tailFlag, validate: validateTail},
+	{name: sinceFlag, validate: validateSince},
+	{name: previousFlag, short: "p", boolean: true},
+	{name: replicasFlag, validate: validateReplicas},
+	{name: toRevisionFlag, validate: validateRevision},
+}
+
+// ParseError describes why a command could not be parsed and where in the command the problem was found
+// Position is the 1-based character offset in the command
+type ParseError struct {
+	Position int
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+// token is a single word from a command and the 1-based character offset it started at
+type token struct {
+	value  string
+	pos    int
+	quoted bool
+}
+
+// tokenize splits the command into whitespace separated tokens.
+// Single and double quotes group words into a single token and a backslash escapes the next character.
+func tokenize(command string) ([]token, error) {
+	var tokens []token
+	var current strings.Builder
+	inToken := false
+	quoted := false
+	start := 0
+	var quote rune
+	quoteStart := 0
+	escaped := false
+
+	pos := 0
+	for _, r := range command {
+		pos++
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+			continue
+		case r == '"' || r == '\'':
+			quote = r
+			quoteStart = pos
+			quoted = quoted || !inToken // only tokens starting with a quote are considered quoted
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, token{value: current.String(), pos: start, quoted: quoted})
+				current.Reset()
+				inToken = false
+				quoted = false
+			}
+			continue
+		default:
+			current.WriteRune(r)
+		}
+		if !inToken {
+			inToken = true
+			start = pos
+		}
+	}
+
+	if escaped {
+		return nil, &ParseError{Position: pos, Message: "unexpected end of command after escape character"}
+	}
+	if quote != 0 {
+		return nil, &ParseError{Position: quoteStart, Message: fmt.Sprintf("unterminated %c quote", quote)}
+	}
+	if inToken {
+		tokens = append(tokens, token{value: current.String(), pos: start, quoted: quoted})
+	}
+	return tokens, nil
+}
+
+// syntax describes the positional arguments and flags accepted by a verb
+type syntax struct {
+	resource      string            // resource implied by the verb, otherwise the resource is the first positional argument
+	nameRequired  bool              // whether the name of the resource must be given
+	flags         []string          // names of the flags accepted by the verb
+	requiredFlags []string          // names of the flags that must be given
+	subcommands   map[string]syntax // syntax of each subcommand when the verb requires one. i.e. rollout restart
+}
+
+// usage returns a description of the expected format for the verb
+func (s syntax) usage(verb string) string {
+	usage := []string{verb}
+	if len(s.subcommands) > 0 {
+		var subcommands []string
+		for subcommand := range s.subcommands {
+			subcommands = append(subcommands, subcommand)
+		}
+		sort.Strings(subcommands)
+		return fmt.Sprintf("%s <%s> ...", verb, strings.Join(subcommands, "|"))
+	}
+	if s.resource == "" {
+		usage = append(usage, "<resource>")
+	}
+	usage = append(usage, "<namespace>")
+	if s.nameRequired {
+		usage = append(usage, "<name>")
+	} else {
+		usage = append(usage, "[name]")
+	}
+	for _, flag := range s.requiredFlags {
+		usage = append(usage, fmt.Sprintf("--%s=<%s>", flag, flag))
+	}
+	return strings.Join(usage, " ")
+}
+
+var defaultSyntax = syntax{
+	flags: []string{labelSelectorFlag, fieldSelectorFlag},
+}
+
+var verbSyntax = map[string]syntax{
+	"describe": {
+		nameRequired: true,
+	},
+	"logs": {
+		resource:     "pods",
+		nameRequired: true,
+		flags:        []string{containerFlag, tailFlag, sinceFlag, previousFlag},
+	},
+	"scale": {
+		resource:      "deployments",
+		nameRequired:  true,
+		flags:         []string{replicasFlag},
+		requiredFlags: []string{replicasFlag},
+	},
+	"rollout": {
+		subcommands: map[string]syntax{
+			"restart": {
+				resource:     "deployments",
+				nameRequired: true,
+			},
+			"status": {
+				resource:     "deployments",
+				nameRequired: true,
+			},
+			"history": {
+				resource:     "deployments",
+				nameRequired: true,
+			},
+			"undo": {
+				resource:     "deployments",
+				nameRequired: true,
+				flags:        []string{toRevisionFlag},
+			},
+		},
+	},
+}
+
+// syntaxForVerb returns the syntax of the given verb, verbs without a specific syntax use the default syntax
+func syntaxForVerb(verb string) syntax {
+	if s, ok := verbSyntax[strings.ToLower(verb)]; ok {
+		return s
+	}
+	return defaultSyntax
+}
+
+// parseCommand tokenizes the command and returns the Command it describes without checking any permissions
+// The expected format is: <verb> <resource> <namespace> [name] [flags...]
+// unless the verb has a specific syntax, i.e. logs <namespace> <name> [flags...] or rollout restart <namespace> <name>
+func parseCommand(command string) (Command, error) {
+	tokens, err := tokenize(command)
+	if err != nil {
+		return Command{}, err
+	}
+
+	end := len([]rune(command)) + 1
+	if len(tokens) == 0 || isFlag(tokens[0]) {
+		return Command{}, &ParseError{Position: end, Message: "missing verb, expected: <verb> <resource> <namespace> [name]"}
+	}
+	// the verb and subcommand are lowercased so that every check of them agrees. i.e. DELETE requires confirmation
+	verb := strings.ToLower(tokens[0].value)
+	verbSyntax := syntaxForVerb(verb)
+	tokens = tokens[1:]
+
+	parsed := Command{
+		Verb: verb,
+	}
+	usage := verbSyntax.usage(verb)
+	if len(verbSyntax.subcommands) > 0 {
+		if len(tokens) == 0 || isFlag(tokens[0]) {
+			return Command{}, &ParseError{Position: end, Message: fmt.Sprintf("missing subcommand, expected: %s", usage)}
+		}
+		subcommand := tokens[0]
+		subcommandSyntax, ok := verbSyntax.subcommands[strings.ToLower(subcommand.value)]
+		if !ok {
+			return Command{}, &ParseError{
+				Position: subcommand.pos,
+				Message:  fmt.Sprintf("unknown subcommand %s, expected: %s", subcommand.value, usage),
+			}
+		}
+		parsed.Subcommand = strings.ToLower(subcommand.value)
+		verbSyntax = subcommandSyntax
+		usage = verbSyntax.usage(parsed.Action())
+		tokens = tokens[1:]
+	}
+
+	positional, flags, err := parseFlags(tokens, verbSyntax.flags)
+	if err != nil {
+		return Command{}, err
+	}
+	parsed.Flags = flags
+
+	expected := []string{"namespace"}
+	if verbSyntax.resource == "" {
+		expected = append([]string{"resource"}, expected...)
+	}
+	if verbSyntax.nameRequired {
+		expected = append(expected, "name")
+	}
+	for i, name := range expected {
+		if len(positional) <= i {
+			return Command{}, &ParseError{
+				Position: end,
+				Message:  fmt.Sprintf("missing %s, expected: %s", name, usage),
+			}
+		}
+	}
+	for _, flag := range verbSyntax.requiredFlags {
+		if _, ok := flags[flag]; !ok {
+			return Command{}, &ParseError{
+				Position: end,
+				Message:  fmt.Sprintf("missing flag --%s, expected: %s", flag, usage),
+			}
+		}
+	}
+
+	parsed.Resource = verbSyntax.resource
+	if parsed.Resource == "" {
+		parsed.Resource, positional = positional[0].value, positional[1:]
+	}
+	parsed.Namespace, positional = positional[0].value, positional[1:]
+	if len(positional) > 0 {
+		parsed.Name, positional = positional[0].value, positional[1:]
+	}
+	if len(positional) > 0 {
+		return Command{}, &ParseError{
+			Position: positional[0].pos,
+			Message:  fmt.Sprintf("unexpected argument %s, expected: %s", positional[0].value, usage),
+		}
+	}
+	return parsed, nil
+}
+
+// isFlag returns whether the token should be treated as a flag rather than a positional argument
+func isFlag(t token) bool {
+	return !t.quoted && strings.HasPrefix(t.value, "-") && t.value != "-"
+}
+
+// parseFlags separates the flags from the positional tokens and ensures that only the allowed flags are given
+// flags can be given as --name=value, --name value, -n=value or -n value.
+// Boolean flags don't need a value but can be followed by true or false. i.e. --previous false
+// Quoted tokens are never treated as flags.
+func parseFlags(tokens []token, allowed []string) ([]token, map[string]string, error) {
+	var positional []token
+	flags := map[string]string{}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if !isFlag(t) {
+			positional = append(positional, t)
+			continue
+		}
+
+		name := strings.TrimLeft(t.value, "-")
+		long := strings.HasPrefix(t.value, "--")
+		value := ""
+		hasValue := false
+		if idx := strings.Index(name, "="); idx >= 0 {
+			name, value, hasValue = name[:idx], name[idx+1:], true
+		}
+
+		spec, ok := lookupFlag(name, long)
+		if !ok || !stringInSlice(spec.name, allowed) {
+			return nil, nil, &ParseError{Position: t.pos, Message: fmt.Sprintf("unknown flag %s", t.value)}
+		}
+		if _, exists := flags[spec.name]; exists {
+			return nil, nil, &ParseError{Position: t.pos, Message: fmt.Sprintf("flag %s specified more than once", t.value)}
+		}
+
+		switch {
+		case spec.boolean && hasValue:
+			if value != "true" && value != "false" {
+				return nil, nil, &ParseError{Position: t.pos, Message: fmt.Sprintf("flag %s expects true or false", t.value)}
+			}
+		case spec.boolean:
+			value = "true"
+			// an explicit value is consumed so that --previous false isn't treated as --previous with an extra argument
+			if i+1 < len(tokens) && !tokens[i+1].quoted && (tokens[i+1].value == "true" || tokens[i+1].value == "false") {
+				i++
+				value = tokens[i].value
+			}
+		case !hasValue:
+			if i+1 >= len(tokens) {
+				return nil, nil, &ParseError{Position: t.pos, Message: fmt.Sprintf("flag %s requires a value", t.value)}
+			}
+			i++
+			value = tokens[i].value
+		}
+		if spec.validate != nil {
+			if err := spec.validate(value); err != nil {
+				return nil, nil, &ParseError{Position: t.pos, Message: fmt.Sprintf("invalid value for flag %s: %v", t.value, err)}
+			}
+		}
+		flags[spec.name] = value
+	}
+	return positional, flags, nil
+}
+
+// lookupFlag returns the flag spec for the given long or short flag name
+func lookupFlag(name string, long bool) (flagSpec, bool) {
+	for _, spec := range flagSpecs {
+		if (long && spec.name == name) || (!long && spec.short != "" && spec.short == name) {
+			return spec, true
+		}
+	}
+	return flagSpec{}, false
+}
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
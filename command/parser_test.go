@@ -0,0 +1,115 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected Command
+	}{
+		{
+			command:  "get pods default",
+			expected: Command{Verb: "get", Resource: "pods", Namespace: "default", Flags: map[string]string{}},
+		},
+		{
+			command:  "  get\tpods   default  nginx-1 \n",
+			expected: Command{Verb: "get", Resource: "pods", Namespace: "default", Name: "nginx-1", Flags: map[string]string{}},
+		},
+		{
+			command: `get pods default -l app=nginx "first arg"`,
+			expected: Command{
+				Verb: "get", Resource: "pods", Namespace: "default",
+				Name:  "first arg",
+				Flags: map[string]string{"selector": "app=nginx"},
+			},
+		},
+		{
+			command: `get pods default --selector="app in (nginx, redis)"`,
+			expected: Command{
+				Verb: "get", Resource: "pods", Namespace: "default",
+				Flags: map[string]string{"selector": "app in (nginx, redis)"},
+			},
+		},
+		{
+			command:  "logs default web --previous false",
+			expected: Command{Verb: "logs", Resource: "pods", Namespace: "default", Name: "web", Flags: map[string]string{"previous": "false"}},
+		},
+		{
+			command:  "logs default --previous true web",
+			expected: Command{Verb: "logs", Resource: "pods", Namespace: "default", Name: "web", Flags: map[string]string{"previous": "true"}},
+		},
+		{
+			command:  "logs default web --previous",
+			expected: Command{Verb: "logs", Resource: "pods", Namespace: "default", Name: "web", Flags: map[string]string{"previous": "true"}},
+		},
+		{
+			command:  "DELETE pods default nginx",
+			expected: Command{Verb: "delete", Resource: "pods", Namespace: "default", Name: "nginx", Flags: map[string]string{}},
+		},
+		{
+			command:  "Rollout Undo default nginx",
+			expected: Command{Verb: "rollout", Subcommand: "undo", Resource: "deployments", Namespace: "default", Name: "nginx", Flags: map[string]string{}},
+		},
+		{
+			command: `get pods default "-l"`,
+			expected: Command{
+				Verb: "get", Resource: "pods", Namespace: "default", Name: "-l",
+				Flags: map[string]string{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			if !reflect.DeepEqual(parsed, test.expected) {
+				t.Fatalf("unexpected command, got %+v, expected %+v", parsed, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"get pods", "missing namespace, expected: get <resource> <namespace> [name] at position 9"},
+		{"logs nginx", "missing name, expected: logs <namespace> <name> at position 11"},
+		{"logs nginx nginx-1 -l app=nginx", "unknown flag -l at position 20"},
+		{"logs nginx nginx-1 --tail=-1", "invalid value for flag --tail=-1: expected a number of lines between 1 and 1000 at position 20"},
+		{"logs nginx nginx-1 --tail 0", "invalid value for flag --tail: expected a number of lines between 1 and 1000 at position 20"},
+		{"logs nginx nginx-1 --tail 100000000", "invalid value for flag --tail: expected a number of lines between 1 and 1000 at position 20"},
+		{"get pods nginx --previous", "unknown flag --previous at position 16"},
+		{"", "missing verb, expected: <verb> <resource> <namespace> [name] at position 1"},
+		{`get pods "default`, "unterminated \" quote at position 10"},
+		{`get pods default\`, "unexpected end of command after escape character at position 17"},
+		{"get pods default --unknown", "unknown flag --unknown at position 18"},
+		{"get pods default -l", "flag -l requires a value at position 18"},
+		{"get pods default -l a=b --selector c=d", "flag --selector specified more than once at position 25"},
+		{"delete pods default a b c", "unexpected argument b, expected: delete <resource> <namespace> [name] at position 23"},
+		{`get pods default -l app=nginx "first arg" 'second \arg'`, "unexpected argument second \\arg, expected: get <resource> <namespace> [name] at position 43"},
+		{"logs default web extra", "unexpected argument extra, expected: logs <namespace> <name> at position 18"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			_, err := parseCommand(test.command)
+			if err == nil {
+				t.Fatalf("expected command to be invalid")
+			}
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("expected a *ParseError, instead got %T", err)
+			}
+			if err.Error() != test.expected {
+				t.Fatalf("unexpected error, got '%v', expected '%s'", err, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/config"
+	"github.com/daniel-cole/teams-kontrol/util"
+)
+
+// Requester identifies the teams user that sent a command and the team and channel it was sent from
+type Requester struct {
+	AADObjectID string
+	Name        string
+	TeamID      string
+	ChannelID   string
+}
+
+// ruleAppliesTo returns whether the requester is a subject of the rule and is in one of the rule's teams and channels
+// subjects, teams and channels that aren't specified in the rule match every requester
+func ruleAppliesTo(rule config.Rule, requester Requester) bool {
+	if len(rule.Teams) > 0 && !util.StringInSliceIgnoreCase(requester.TeamID, rule.Teams) {
+		return false
+	}
+	if len(rule.Channels) > 0 && !util.StringInSliceIgnoreCase(requester.ChannelID, rule.Channels) {
+		return false
+	}
+	if len(rule.Subjects) == 0 {
+		return true
+	}
+	for _, subject := range rule.Subjects {
+		if subject.Matches(requester.AADObjectID, requester.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleMatches returns whether the command is one of the combinations described by the rule
+// The resources of the command and the rule are both canonical, see canonicalResource.
+func ruleMatches(rule config.Rule, command Command) bool {
+	if !matchesAny(command.Action(), rule.Verbs) ||
+		!matchesAny(command.Resource, rule.Resources) ||
+		!rule.Namespaces.Matches(command.Namespace) {
+		return false
+	}
+	if len(rule.ResourceNames) > 0 {
+		return command.Name != "" && rule.ResourceNames.Matches(command.Name)
+	}
+	return true
+}
+
+// matchesAny returns whether the value is in the list ignoring case or the list contains the wildcard
+func matchesAny(value string, list []string) bool {
+	return util.StringInSliceIgnoreCase(config.Wildcard, list) || util.StringInSliceIgnoreCase(value, list)
+}
+
+// authorize checks that the command is permitted for the requester.
+// A command is permitted when a single rule that applies to the requester matches every part of it
+// and no deny rule that applies to the requester matches it.
+func authorize(p config.Permissions, requester Requester, command Command) error {
+	allowed := ruleMatches(p.EveryoneRule(), command)
+	for i, rule := range p.Rules {
+		if !ruleAppliesTo(rule, requester) || !ruleMatches(rule, command) {
+			continue
+		}
+		if rule.Deny {
+			return errors.New(fmt.Sprintf("permission error - %s denied by rule %d", describePermission(command), i))
+		}
+		allowed = true
+	}
+
+	if !allowed {
+		return errors.New(fmt.Sprintf("permission error - no rule allows %s", describePermission(command)))
+	}
+	return checkSelectorPermissions(command, p.Selectors)
+}
+
+// describePermission describes what the command requires permission for. i.e. delete pods/nginx in namespace default
+func describePermission(command Command) string {
+	resource := command.Resource
+	if command.Name != "" {
+		resource += "/" + command.Name
+	}
+	return fmt.Sprintf("%s %s in namespace %s", command.Action(), resource, command.Namespace)
+}
@@ -0,0 +1,459 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/config"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"testing"
+)
+
+const rulesPermissions = `
+verbs:
+  - "get"
+resources:
+  - "pods"
+namespaces:
+  - "default"
+rules:
+  - subjects:
+      - aadObjectId: "6a1f1b3c-2d4e-4f50-8a6b-7c8d9e0f1a2b"
+      - name: "Jane SRE"
+    verbs:
+      - "delete"
+    resources:
+      - "pods"
+    namespaces:
+      - "default"
+`
+
+var junior = Requester{AADObjectID: "11111111-2222-3333-4444-555555555555", Name: "Joe Junior"}
+var sre = Requester{AADObjectID: "6A1F1B3C-2D4E-4F50-8A6B-7C8D9E0F1A2B", Name: "Some SRE"}
+var sreByName = Requester{AADObjectID: "99999999-2222-3333-4444-555555555555", Name: "jane sre"}
+
+func loadTestPermissions(t *testing.T, permissionsYAML string) config.Permissions {
+	t.Helper()
+	var p config.Permissions
+	err := yaml.Unmarshal([]byte(permissionsYAML), &p)
+	if err != nil {
+		t.Fatalf("failed to unmarshal permissions: %v", err)
+	}
+	err = p.Validate()
+	if err != nil {
+		t.Fatalf("invalid permissions: %v", err)
+	}
+	p, err = canonicalPermissions(p)
+	if err != nil {
+		t.Fatalf("failed to resolve resources: %v", err)
+	}
+	return p
+}
+
+func TestAuthorizeRules(t *testing.T) {
+	p := loadTestPermissions(t, rulesPermissions)
+
+	tests := []struct {
+		requester Requester
+		command   string
+		allowed   bool
+	}{
+		{junior, "get pods default", true},
+		{junior, "delete pods default nginx-1", false},
+		{sre, "get pods default", true},
+		{sre, "delete pods default nginx-1", true},
+		{sreByName, "delete pods default nginx-1", true},
+		{Requester{}, "delete pods default nginx-1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.requester.Name+" "+test.command, func(t *testing.T) {
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			err = authorize(p, test.requester, parsed)
+			if test.allowed && err != nil {
+				t.Fatalf("expected command to be allowed: %v", err)
+			}
+			if !test.allowed && err == nil {
+				t.Fatalf("expected command to be denied")
+			}
+		})
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	invalid := []string{
+		"rules:\n  - verbs: [\"delete\"]\n",
+		"rules:\n  - subjects:\n      - {}\n    verbs: [\"delete\"]\n    resources: [\"pods\"]\n    namespaces: [\"default\"]\n",
+		"rules:\n  - subjects:\n      - name: \"Jane SRE\"\n    verbs: [\"delete\"]\n",
+	}
+	for _, permissionsYAML := range invalid {
+		var p config.Permissions
+		err := yaml.Unmarshal([]byte(permissionsYAML), &p)
+		if err != nil {
+			t.Fatalf("failed to unmarshal permissions: %v", err)
+		}
+		if p.Validate() == nil {
+			t.Errorf("expected permissions to be invalid:\n%s", permissionsYAML)
+		}
+	}
+}
+
+const scopedPermissions = `
+rules:
+  - channels:
+      - "19:payments@thread.skype"
+    verbs:
+      - "get"
+      - "delete"
+    resources:
+      - "pods"
+    namespaces:
+      - "payments"
+  - teams:
+      - "19:platform@thread.skype"
+    subjects:
+      - name: "Jane SRE"
+    verbs:
+      - "get"
+    resources:
+      - "pods"
+    namespaces:
+      - "default"
+`
+
+func TestAuthorizeScopedRules(t *testing.T) {
+	p := loadTestPermissions(t, scopedPermissions)
+
+	paymentsChannel := Requester{Name: "Joe Junior", TeamID: "19:payments-team@thread.skype", ChannelID: "19:payments@thread.skype"}
+	otherChannel := Requester{Name: "Joe Junior", TeamID: "19:payments-team@thread.skype", ChannelID: "19:general@thread.skype"}
+	platformSRE := Requester{Name: "Jane SRE", TeamID: "19:platform@thread.skype", ChannelID: "19:general@thread.skype"}
+	platformJunior := Requester{Name: "Joe Junior", TeamID: "19:platform@thread.skype", ChannelID: "19:general@thread.skype"}
+
+	tests := []struct {
+		requester Requester
+		command   string
+		allowed   bool
+	}{
+		{paymentsChannel, "delete pods payments payments-api-1", true},
+		{paymentsChannel, "get pods default", false},
+		{otherChannel, "get pods payments", false},
+		{platformSRE, "get pods default", true},
+		{platformSRE, "get pods payments", false},
+		{platformJunior, "get pods default", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.requester.ChannelID+" "+test.command, func(t *testing.T) {
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			err = authorize(p, test.requester, parsed)
+			if test.allowed && err != nil {
+				t.Fatalf("expected command to be allowed: %v", err)
+			}
+			if !test.allowed && err == nil {
+				t.Fatalf("expected command to be denied")
+			}
+		})
+	}
+}
+
+const tuplePermissions = `
+verbs:
+  - "get"
+resources:
+  - "pods"
+  - "deployments"
+namespaces:
+  - "default"
+  - "payments"
+rules:
+  - subjects:
+      - name: "Jane SRE"
+    verbs:
+      - "delete"
+    resources:
+      - "pods"
+    namespaces:
+      - "default"
+  - subjects:
+      - name: "Jane SRE"
+    verbs:
+      - "scale"
+    resources:
+      - "deployments"
+    namespaces:
+      - "payments"
+    resourceNames:
+      - "payments-api"
+  - channels:
+      - "19:payments@thread.skype"
+    verbs:
+      - "*"
+    resources:
+      - "*"
+    namespaces:
+      - "payments"
+  - subjects:
+      - name: "Joe Junior"
+    deny: true
+    verbs:
+      - "delete"
+    resources:
+      - "*"
+    namespaces:
+      - "*"
+`
+
+func TestAuthorizeTuples(t *testing.T) {
+	p := loadTestPermissions(t, tuplePermissions)
+
+	jane := Requester{Name: "Jane SRE"}
+	joe := Requester{Name: "Joe Junior"}
+	janePayments := Requester{Name: "Jane SRE", ChannelID: "19:payments@thread.skype"}
+	joePayments := Requester{Name: "Joe Junior", ChannelID: "19:payments@thread.skype"}
+
+	tests := []struct {
+		requester Requester
+		command   string
+		allowed   bool
+	}{
+		{jane, "get deployments payments", true},
+		{jane, "delete pods default nginx-1", true},
+		{jane, "delete pods payments payments-api-1", false},
+		{jane, "delete deployments default nginx", false},
+		{jane, "scale payments payments-api --replicas=3", true},
+		{jane, "scale payments checkout --replicas=3", false},
+		{jane, "scale default payments-api --replicas=3", false},
+		{janePayments, "delete pods payments payments-api-1", true},
+		{janePayments, "rollout restart payments payments-api", true},
+		{janePayments, "rollout restart default nginx", false},
+		{joe, "get pods default", true},
+		{joePayments, "rollout restart payments payments-api", true},
+		{joePayments, "delete pods payments payments-api-1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.requester.Name+" "+test.command, func(t *testing.T) {
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			err = authorize(p, test.requester, parsed)
+			if test.allowed && err != nil {
+				t.Fatalf("expected command to be allowed: %v", err)
+			}
+			if !test.allowed && err == nil {
+				t.Fatalf("expected command to be denied")
+			}
+		})
+	}
+}
+
+const patternPermissions = `
+verbs:
+  - "get"
+resources:
+  - "pods"
+namespaces:
+  - "team-a-*"
+  - "/team-b-(dev|staging)/"
+rules:
+  - subjects:
+      - name: "Jane SRE"
+    verbs:
+      - "delete"
+    resources:
+      - "pods"
+    namespaces:
+      - "team-?-dev"
+    resourceNames:
+      - "/nginx-[0-9]+/"
+`
+
+func TestAuthorizePatterns(t *testing.T) {
+	p := loadTestPermissions(t, patternPermissions)
+
+	jane := Requester{Name: "Jane SRE"}
+
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"get pods team-a-dev", true},
+		{"get pods TEAM-A-STAGING", true},
+		{"get pods team-a", false},
+		{"get pods team-b-dev", true},
+		{"get pods team-b-staging", true},
+		{"get pods team-b-prod", false},
+		{"get pods my-team-b-dev", false},
+		{"delete pods team-b-dev nginx-12", true},
+		{"delete pods team-c-dev nginx-1", true},
+		{"delete pods team-c-dev nginx-a", false},
+		{"delete pods team-c-dev my-nginx-1", false},
+		{"delete pods team-b-staging nginx-1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			parsed, err := parseCommand(test.command)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+			err = authorize(p, jane, parsed)
+			if test.allowed && err != nil {
+				t.Fatalf("expected command to be allowed: %v", err)
+			}
+			if !test.allowed && err == nil {
+				t.Fatalf("expected command to be denied")
+			}
+		})
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	invalid := []string{
+		"namespaces:\n  - \"/team-(a/\"\n",
+		"namespaces:\n  - \"//\"\n",
+		"rules:\n  - subjects:\n      - name: \"Jane SRE\"\n    verbs: [\"delete\"]\n    resources: [\"pods\"]\n    namespaces: [\"default\"]\n    resourceNames: [\"/nginx-[/\"]\n",
+	}
+	for _, permissionsYAML := range invalid {
+		var p config.Permissions
+		if yaml.Unmarshal([]byte(permissionsYAML), &p) == nil {
+			t.Errorf("expected pattern to be rejected:\n%s", permissionsYAML)
+		}
+	}
+}
+
+const denyResourcePermissions = `
+verbs:
+  - "*"
+resources:
+  - "*"
+namespaces:
+  - "default"
+rules:
+  - subjects:
+      - name: "Test User"
+    deny: true
+    verbs:
+      - "*"
+    resources:
+      - "secrets"
+      - "deployments"
+    namespaces:
+      - "*"
+  - subjects:
+      - name: "Test User"
+    deny: true
+    verbs:
+      - "delete"
+    resources:
+      - "certificates"
+    namespaces:
+      - "*"
+`
+
+func TestAuthorizeDenyCanonicalResource(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, denyResourcePermissions))()
+
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"get secrets default", false},
+		{"get secret default", false},
+		{"get secrets. default", false},
+		{"get SECRETS default", false},
+		{"delete deploy default web", false},
+		{"delete deployment default web", false},
+		{"delete deployments.apps default web", false},
+		{"delete cert default web", false},
+		{"delete certificates.cert-manager.io default web", false},
+		{"get cm default", true},
+		{"get pods default", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			_, err := ParseAndValidateCommandFromString(testRequester, test.command)
+			if test.allowed && err != nil {
+				t.Fatalf("expected command to be allowed: %v", err)
+			}
+			if !test.allowed && err == nil {
+				t.Fatalf("expected command to be denied")
+			}
+		})
+	}
+}
+
+// denySpellingsPermissions lists the resources of the deny rule by their singular, short and group qualified names
+const denySpellingsPermissions = `
+verbs:
+  - "*"
+resources:
+  - "*"
+namespaces:
+  - "default"
+rules:
+  - subjects:
+      - name: "Test User"
+    deny: true
+    verbs:
+      - "*"
+    resources:
+      - "secret"
+      - "deploy"
+      - "cm"
+      - "deployments.apps"
+      - "cert"
+    namespaces:
+      - "*"
+`
+
+func TestAuthorizeDenyRuleResourceSpellings(t *testing.T) {
+	defer useTestPermissions(loadTestPermissions(t, denySpellingsPermissions))()
+
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"get secrets default", false},
+		{"get secret default", false},
+		{"delete deployments default web", false},
+		{"delete deploy default web", false},
+		{"get configmaps default", false},
+		{"delete certificates default web", false},
+		{"get pods default", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			_, err := ParseAndValidateCommandFromString(testRequester, test.command)
+			if test.allowed && err != nil {
+				t.Fatalf("expected command to be allowed: %v", err)
+			}
+			if !test.allowed && err == nil {
+				t.Fatalf("expected command to be denied")
+			}
+		})
+	}
+}
+
+func TestUpdatePermissionsUnknownResource(t *testing.T) {
+	defer useTestPermissions(currentPermissions())()
+
+	err := UpdatePermissions([]byte("verbs: [\"get\"]\nresources: [\"widgets\"]\nnamespaces: [\"default\"]\n"), "test")
+	if err == nil {
+		t.Fatal("expected permissions with an unknown resource to be rejected")
+	}
+	err = UpdatePermissions([]byte("verbs: [\"get\"]\nresources: [\"pod\", \"cm\"]\nnamespaces: [\"default\"]\n"), "test")
+	if err != nil {
+		t.Fatalf("failed to update permissions: %v", err)
+	}
+	if resources := currentPermissions().Resources; !reflect.DeepEqual(resources, []string{"pods", "configmaps"}) {
+		t.Errorf("expected resources to be resolved to their plural, instead got %v", resources)
+	}
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"crypto/sha256"
+	"expvar"
+	"github.com/daniel-cole/teams-kontrol/config"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const defaultPermissionReloadInterval = 10 * time.Second
+
+// permissions holds the config.Permissions in use. It's swapped as a whole when the permissions are reloaded
+var permissions atomic.Value
+
+// permissionReloads counts the successful and failed attempts to reload the permissions
+var permissionReloads = expvar.NewMap("permission_reloads")
+
+// currentPermissions returns the permissions in use
+func currentPermissions() config.Permissions {
+	p, _ := permissions.Load().(config.Permissions)
+	return p
+}
+
+// UpdatePermissions parses and validates the permissions, resolves the resources of their rules and swaps them in for the permissions in use.
+// Invalid permissions are rejected and the permissions in use are kept. source describes where they were loaded from.
+func UpdatePermissions(data []byte, source string) error {
+	p, err := config.Parse(data)
+	if err == nil {
+		p, err = canonicalPermissions(p)
+	}
+	if err != nil {
+		permissionReloads.Add("failure", 1)
+		return err
+	}
+	permissions.Store(p)
+	permissionReloads.Add("success", 1)
+	logrus.Infof("loaded permissions from %s with %d rules", source, len(p.Rules))
+	if requiresApprovals(p) && os.Getenv(KontrolApprovalConfigMapEnvKey) == "" {
+		// startup fails in this case, a reload can only be warned about
+		logrus.Warnf("%s isn't set, pending approvals will be lost when teams-kontrol restarts", KontrolApprovalConfigMapEnvKey)
+	}
+	return nil
+}
+
+// PermissionReloadInterval returns how often the permissions file is checked for changes
+func PermissionReloadInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv(KontrolPermissionReloadIntervalEnvKey))
+	if err != nil || interval <= 0 {
+		return defaultPermissionReloadInterval
+	}
+	return interval
+}
+
+// WatchPermissionsFile polls the permissions file loaded by Init and reloads it when its content changes until stop is closed.
+// The content is compared rather than the modification time as a mounted ConfigMap is updated by swapping a symlink.
+func WatchPermissionsFile(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous [sha256.Size]byte
+	if data, err := ioutil.ReadFile(permissionFile); err == nil {
+		previous = sha256.Sum256(data)
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			previous = reloadPermissionsFile(permissionFile, previous)
+		}
+	}
+}
+
+// reloadPermissionsFile reloads the permissions file when its hash differs from the previous hash and returns the new hash
+func reloadPermissionsFile(path string, previous [sha256.Size]byte) [sha256.Size]byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logrus.Errorf("failed to read permissions file %s: %v", path, err)
+		return previous
+	}
+	hash := sha256.Sum256(data)
+	if hash == previous {
+		return previous
+	}
+	err = UpdatePermissions(data, path)
+	if err != nil {
+		// remember the hash so that the same invalid content isn't logged on every poll
+		logrus.Errorf("rejected permissions file %s, keeping the previous permissions: %v", path, err)
+	}
+	return hash
+}
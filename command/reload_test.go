@@ -0,0 +1,71 @@
+package command
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadPermissionsFile(t *testing.T) {
+	original := currentPermissions()
+	defer permissions.Store(original)
+
+	dir, err := ioutil.TempDir("", "permissions")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// mounted ConfigMaps are updated by swapping the ..data symlink to a new directory
+	writeVersion := func(version string, content string) {
+		versionDir := filepath.Join(dir, version)
+		if err := os.Mkdir(versionDir, 0755); err != nil {
+			t.Fatalf("failed to create version dir: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(versionDir, "permissions.yml"), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write permissions: %v", err)
+		}
+		link := filepath.Join(dir, "..data_tmp")
+		if err := os.Symlink(version, link); err != nil {
+			t.Fatalf("failed to create symlink: %v", err)
+		}
+		if err := os.Rename(link, filepath.Join(dir, "..data")); err != nil {
+			t.Fatalf("failed to swap symlink: %v", err)
+		}
+	}
+	writeVersion("v1", "verbs: [\"get\"]\nresources: [\"pods\"]\nnamespaces: [\"default\"]\n")
+	path := filepath.Join(dir, "permissions.yml")
+	if err := os.Symlink(filepath.Join("..data", "permissions.yml"), path); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	allowed := func(command string) bool {
+		parsed, err := parseCommand(command)
+		if err != nil {
+			t.Fatalf("failed to parse command: %v", err)
+		}
+		return authorize(currentPermissions(), testRequester, parsed) == nil
+	}
+
+	hash := reloadPermissionsFile(path, [sha256.Size]byte{})
+	if !allowed("get pods default") || allowed("get pods redis") {
+		t.Fatalf("expected the first version of the permissions to be loaded")
+	}
+	if reloadPermissionsFile(path, hash) != hash {
+		t.Fatalf("expected the hash to be unchanged when the file hasn't changed")
+	}
+
+	writeVersion("v2", "verbs: [\"get\"]\nresources: [\"pods\"]\nnamespaces: [\"redis\"]\n")
+	hash = reloadPermissionsFile(path, hash)
+	if allowed("get pods default") || !allowed("get pods redis") {
+		t.Fatalf("expected the second version of the permissions to be loaded")
+	}
+
+	writeVersion("v3", "namespaces: [\"/redis-(/\"]\n")
+	reloadPermissionsFile(path, hash)
+	if !allowed("get pods redis") {
+		t.Fatalf("expected invalid permissions to be rejected and the previous permissions kept")
+	}
+}
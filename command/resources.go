@@ -0,0 +1,86 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/config"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	"strings"
+)
+
+// discoveryClients returns the clients that resources are resolved with, it's replaced in tests
+var discoveryClients = k8s.DefaultClients
+
+// canonicalResource resolves the resource as it was written in the command to the name that permissions are checked against,
+// so that every spelling of a resource is matched by the same rules. i.e. secret, secrets. and secrets are all secrets
+// Resources outside of the core and apps groups are qualified with their group. i.e. certificates.cert-manager.io
+func canonicalResource(resource string) (string, error) {
+	resource = strings.ToLower(resource)
+	switch resource {
+	case "pod", "pods":
+		return "pods", nil
+	case "deploy", "deployment", "deployments":
+		return "deployments", nil
+	}
+
+	clients := discoveryClients()
+	if clients.Kubernetes == nil {
+		return "", errors.New(fmt.Sprintf("unable to resolve resource %s: kubernetes client has not been created", resource))
+	}
+	mapping, err := k8s.ResolveResource(clients, resource)
+	if err != nil {
+		return "", err
+	}
+	groupResource := mapping.Resource.GroupResource()
+	if groupResource.Group == "" || groupResource.Group == "apps" {
+		return groupResource.Resource, nil
+	}
+	return groupResource.String(), nil
+}
+
+// canonicalPermissions returns the permissions with the resources of every rule resolved to their canonical names,
+// so that a rule matches a resource however it's written in the rule or the command. i.e. a deny rule for secret
+// An error is returned for a resource that can't be resolved rather than leaving a rule that never matches.
+func canonicalPermissions(p config.Permissions) (config.Permissions, error) {
+	var err error
+	p.Resources, err = canonicalResources(p.Resources, "the top level")
+	if err != nil {
+		return config.Permissions{}, err
+	}
+	rules := make([]config.Rule, len(p.Rules))
+	for i, rule := range p.Rules {
+		rule.Resources, err = canonicalResources(rule.Resources, fmt.Sprintf("rule %d", i))
+		if err != nil {
+			return config.Permissions{}, err
+		}
+		rules[i] = rule
+	}
+	p.Rules = rules
+	roles := make([]config.ElevatedRole, len(p.Elevation.Roles))
+	for i, role := range p.Elevation.Roles {
+		role.Resources, err = canonicalResources(role.Resources, "elevated role "+role.Name)
+		if err != nil {
+			return config.Permissions{}, err
+		}
+		roles[i] = role
+	}
+	p.Elevation.Roles = roles
+	return p, nil
+}
+
+// canonicalResources resolves each of the resources other than the wildcard, name identifies where they're listed in errors
+func canonicalResources(resources []string, name string) ([]string, error) {
+	var canonical []string
+	for _, resource := range resources {
+		if resource == config.Wildcard {
+			canonical = append(canonical, resource)
+			continue
+		}
+		resolved, err := canonicalResource(resource)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid resource %s in %s: %v", resource, name, err))
+		}
+		canonical = append(canonical, resolved)
+	}
+	return canonical, nil
+}
@@ -0,0 +1,162 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// rolloutDeployment returns a deployment at revision 3 along with the replica sets for revisions 1 to 3
+func rolloutDeployment() (*appsv1.Deployment, []*appsv1.ReplicaSet) {
+	deployment := simpleDeployment("nginx", "nginx", 3)
+	deployment.UID = types.UID("8b1c6b2a-0f6e-4a59-9c1a-6a0f1c1b6d11")
+	deployment.Annotations = map[string]string{k8s.RevisionAnnotation: "3"}
+	deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}}
+	deployment.Spec.Template.Labels = map[string]string{"app": "nginx"}
+	deployment.Spec.Template.Spec.Containers[0].Image = "nginx:1.17.3"
+
+	isController := true
+	var replicaSets []*appsv1.ReplicaSet
+	for revision, image := range []string{"nginx:1.17.1", "nginx:1.17.2", "nginx:1.17.3"} {
+		replicaSets = append(replicaSets, &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "nginx-" + strconv.Itoa(revision+1),
+				Namespace: "nginx",
+				Labels:    map[string]string{"app": "nginx", "pod-template-hash": strconv.Itoa(revision + 1)},
+				Annotations: map[string]string{
+					k8s.RevisionAnnotation:    strconv.Itoa(revision + 1),
+					k8s.ChangeCauseAnnotation: "release " + image,
+				},
+				CreationTimestamp: metav1.NewTime(goldenCreationTimestamp.Add(time.Duration(revision) * time.Hour)),
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Name:       deployment.Name,
+					UID:        deployment.UID,
+					Controller: &isController,
+				}},
+			},
+			Spec: appsv1.ReplicaSetSpec{
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{"app": "nginx", "pod-template-hash": strconv.Itoa(revision + 1)},
+					},
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{Name: "nginx", Image: image}},
+					},
+				},
+			},
+		})
+	}
+	return deployment, replicaSets
+}
+
+func rolloutClient() *fake.Clientset {
+	deployment, replicaSets := rolloutDeployment()
+	client := fake.NewSimpleClientset(deployment)
+	for _, replicaSet := range replicaSets {
+		_, _ = client.AppsV1().ReplicaSets(replicaSet.Namespace).Create(replicaSet)
+	}
+	return client
+}
+
+func executeCommandString(t *testing.T, client *fake.Clientset, commandStr string) interface{} {
+	t.Helper()
+	command, err := ParseAndValidateCommandFromString(testRequester, commandStr)
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+	return result
+}
+
+func TestExecuteRolloutStatusCommand(t *testing.T) {
+	result := executeCommandString(t, rolloutClient(), "rollout status nginx nginx")
+
+	status, ok := result.(*k8s.DeploymentRolloutStatus)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+	if status.Complete {
+		t.Fatalf("expected rollout to be in progress as not all replicas are available")
+	}
+
+	assertGoldenCard(t, "rollout_status.json", rolloutStatusCard(status))
+}
+
+func TestExecuteRolloutHistoryCommand(t *testing.T) {
+	result := executeCommandString(t, rolloutClient(), "rollout history nginx nginx")
+
+	history, ok := result.(*k8s.DeploymentHistory)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+	if len(history.Revisions) != 3 {
+		t.Fatalf("expected 3 revisions, instead got %d", len(history.Revisions))
+	}
+	for i, revision := range history.Revisions {
+		if revision.Revision != int64(i+1) {
+			t.Fatalf("expected revisions to be sorted, instead got %d at index %d", revision.Revision, i)
+		}
+	}
+
+	assertGoldenCard(t, "rollout_history.json", rolloutHistoryCard(history))
+}
+
+func TestExecuteRolloutUndoCommand(t *testing.T) {
+	tests := []struct {
+		command          string
+		expectedRevision int64
+		expectedImages   []string
+		golden           string
+	}{
+		{"rollout undo nginx nginx", 2, []string{"nginx:1.17.2"}, "rollout_undo.json"},
+		{"rollout undo nginx nginx --to-revision=1", 1, []string{"nginx:1.17.1"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			result := executeCommandString(t, rolloutClient(), test.command)
+
+			rollback, ok := result.(*k8s.DeploymentRollback)
+			if !ok {
+				t.Fatalf("got unexpected result type: %T", result)
+			}
+			if rollback.FromRevision != 3 || rollback.ToRevision != test.expectedRevision {
+				t.Fatalf("expected rollback from revision 3 to %d, instead got %d to %d",
+					test.expectedRevision, rollback.FromRevision, rollback.ToRevision)
+			}
+			if !reflect.DeepEqual(rollback.Images, test.expectedImages) {
+				t.Fatalf("expected images to be %v, instead got %v", test.expectedImages, rollback.Images)
+			}
+			if _, ok := rollback.Deployment.Spec.Template.Labels["pod-template-hash"]; ok {
+				t.Fatalf("expected pod-template-hash label to be removed from the pod template")
+			}
+
+			if test.golden != "" {
+				assertGoldenCard(t, test.golden, rolloutUndoCard(rollback))
+			}
+		})
+	}
+}
+
+func TestExecuteRolloutUndoUnknownRevision(t *testing.T) {
+	command, err := ParseAndValidateCommandFromString(testRequester, "rollout undo nginx nginx --to-revision=7")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	_, err = ExecuteCommand(k8s.Clients{Kubernetes: rolloutClient()}, command)
+	if err == nil {
+		t.Fatalf("expected rollback to an unknown revision to fail")
+	}
+}
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"errors"
+	"github.com/daniel-cole/teams-kontrol/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const labelSelectorFlag = "selector"
+const fieldSelectorFlag = "field-selector"
+
+func validateLabelSelector(selector string) error {
+	_, err := labels.Parse(selector)
+	return err
+}
+
+func validateFieldSelector(selector string) error {
+	_, err := fields.ParseSelector(selector)
+	return err
+}
+
+// checkSelectorPermissions ensures that every label key and field used in the command's selectors is allowed
+func checkSelectorPermissions(command Command, allowed config.Selectors) error {
+	labelSelector, hasLabelSelector := command.Flags[labelSelectorFlag]
+	fieldSelector, hasFieldSelector := command.Flags[fieldSelectorFlag]
+	if !hasLabelSelector && !hasFieldSelector {
+		return nil
+	}
+
+	if command.Name != "" {
+		return errors.New("selectors can only be used when listing resources")
+	}
+
+	if hasLabelSelector {
+		requirements, err := labels.ParseToRequirements(labelSelector)
+		if err != nil {
+			return err
+		}
+		for _, requirement := range requirements {
+			err = checkPermission("label selector", requirement.Key(), allowed.Labels)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if hasFieldSelector {
+		selector, err := fields.ParseSelector(fieldSelector)
+		if err != nil {
+			return err
+		}
+		for _, requirement := range selector.Requirements() {
+			err = checkPermission("field selector", requirement.Field, allowed.Fields)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// listOptions returns the list options for the selectors given to the command
+func listOptions(command Command) metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: command.Flags[labelSelectorFlag],
+		FieldSelector: command.Flags[fieldSelectorFlag],
+	}
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func TestExecuteGetPodsWithLabelSelector(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-1", Namespace: "nginx", Labels: map[string]string{"app": "nginx"}}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "redis-1", Namespace: "nginx", Labels: map[string]string{"app": "redis"}}},
+	)
+
+	command, err := ParseAndValidateCommandFromString(testRequester, "get pods nginx -l app=nginx --field-selector status.phase!=Failed")
+	if err != nil {
+		t.Fatalf("failed to parse and validate command: %v", err)
+	}
+	result, err := ExecuteCommand(k8s.Clients{Kubernetes: client}, command)
+	if err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+
+	podList, ok := result.(*v1.PodList)
+	if !ok {
+		t.Fatalf("got unexpected result type: %T", result)
+	}
+	if len(podList.Items) != 1 || podList.Items[0].Name != "nginx-1" {
+		t.Fatalf("expected only nginx-1 to be returned, instead got %v", podList.Items)
+	}
+}
+
+func TestParseAndValidateSelectorsInvalid(t *testing.T) {
+	invalidCommands := []string{
+		"get pods nginx -l tier=frontend",                 // label key not allowed
+		"get pods nginx -l app=nginx,tier=frontend",       // any label key not allowed
+		"get pods nginx --field-selector spec.nodeName=a", // field not allowed
+		"get pods nginx nginx-1 -l app=nginx",             // selectors can't be used with a name
+		"get pods nginx -l app=(nginx",                    // invalid selector
+	}
+
+	for _, invalidCommand := range invalidCommands {
+		_, err := ParseAndValidateCommandFromString(testRequester, invalidCommand)
+		if err == nil {
+			t.Errorf("expected command to be invalid: %s", invalidCommand)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"os"
+	"strings"
+)
+
+const defaultPermissionConfigMapKey = "permissions.yml"
+
+// WatchPermissions keeps the permissions up to date with their source until stop is closed.
+// Permissions loaded from a config map or KontrolPolicy are watched with an informer and an error is returned
+// if they can't be loaded initially. Otherwise the permissions file loaded by Init is polled for changes.
+func WatchPermissions(clients k8s.Clients, stop <-chan struct{}) error {
+	switch {
+	case permissionConfigMap != "":
+		namespace, name, err := splitNamespacedName(permissionConfigMap)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid %s: %v", KontrolPermissionConfigMapEnvKey, err))
+		}
+		key := os.Getenv(KontrolPermissionConfigMapKeyEnvKey)
+		if key == "" {
+			key = defaultPermissionConfigMapKey
+		}
+		return k8s.WatchConfigMap(clients, namespace, name, func(configMap *v1.ConfigMap) error {
+			return updatePermissionsFromConfigMap(configMap, key)
+		}, stop)
+
+	case permissionPolicy != "":
+		namespace, name, err := splitNamespacedName(permissionPolicy)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid %s: %v", KontrolPermissionPolicyEnvKey, err))
+		}
+		return k8s.WatchKontrolPolicy(clients, namespace, name, updatePermissionsFromPolicy, stop)
+
+	default:
+		go WatchPermissionsFile(PermissionReloadInterval(), stop)
+		return nil
+	}
+}
+
+// updatePermissionsFromConfigMap loads the permissions stored under the key of the config map
+func updatePermissionsFromConfigMap(configMap *v1.ConfigMap, key string) error {
+	source := fmt.Sprintf("config map %s/%s", configMap.Namespace, configMap.Name)
+	data, ok := configMap.Data[key]
+	if !ok {
+		permissionReloads.Add("failure", 1)
+		return rejectPermissions(source, errors.New(fmt.Sprintf("missing key %s", key)))
+	}
+	err := UpdatePermissions([]byte(data), source)
+	if err != nil {
+		return rejectPermissions(source, err)
+	}
+	return nil
+}
+
+// updatePermissionsFromPolicy loads the permissions from the spec of the KontrolPolicy.
+// The spec has the same structure as the permissions file.
+func updatePermissionsFromPolicy(policy *unstructured.Unstructured) error {
+	source := fmt.Sprintf("kontrol policy %s/%s", policy.GetNamespace(), policy.GetName())
+	spec, ok := policy.Object["spec"]
+	if !ok {
+		permissionReloads.Add("failure", 1)
+		return rejectPermissions(source, errors.New("missing spec"))
+	}
+	// YAML is a superset of JSON so the spec can be parsed the same way as the permissions file
+	data, err := json.Marshal(spec)
+	if err != nil {
+		permissionReloads.Add("failure", 1)
+		return rejectPermissions(source, err)
+	}
+	err = UpdatePermissions(data, source)
+	if err != nil {
+		return rejectPermissions(source, err)
+	}
+	return nil
+}
+
+// rejectPermissions logs that the permissions from the source were rejected and returns the reason
+func rejectPermissions(source string, err error) error {
+	logrus.Errorf("rejected permissions from %s, keeping the previous permissions: %v", source, err)
+	return errors.New(fmt.Sprintf("failed to load permissions from %s: %v", source, err))
+}
+
+// splitNamespacedName splits a value of the form <namespace>/<name>
+func splitNamespacedName(value string) (string, string, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New(fmt.Sprintf("expected <namespace>/<name>, got %s", value))
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,139 @@
+package command
+
+import (
+	"github.com/daniel-cole/teams-kontrol/k8s"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+// watchTestPermissions sets the source of the permissions and returns a function that restores the original permissions
+func watchTestPermissions(configMap string, policy string) func() {
+	original := currentPermissions()
+	permissionConfigMap = configMap
+	permissionPolicy = policy
+	return func() {
+		permissions.Store(original)
+		permissionConfigMap = ""
+		permissionPolicy = ""
+	}
+}
+
+// waitForPermissions waits for the informer to deliver an update that changes whether the command is allowed
+func waitForPermissions(t *testing.T, command string, allowed bool) {
+	t.Helper()
+	parsed, err := parseCommand(command)
+	if err != nil {
+		t.Fatalf("failed to parse command: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if (authorize(currentPermissions(), testRequester, parsed) == nil) == allowed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s to be allowed: %t", command, allowed)
+}
+
+func TestWatchPermissionsConfigMap(t *testing.T) {
+	defer watchTestPermissions("teams-kontrol/permissions", "")()
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "permissions", Namespace: "teams-kontrol"},
+		Data: map[string]string{
+			"permissions.yml": "verbs: [\"get\"]\nresources: [\"pods\"]\nnamespaces: [\"payments\"]\n",
+		},
+	}
+	client := fake.NewSimpleClientset(configMap)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	err := WatchPermissions(k8s.Clients{Kubernetes: client}, stop)
+	if err != nil {
+		t.Fatalf("failed to watch permissions: %v", err)
+	}
+	waitForPermissions(t, "get pods payments", true)
+
+	configMap = configMap.DeepCopy()
+	configMap.Data["permissions.yml"] = "namespaces: [\"/payments-(/\"]\n"
+	_, err = client.CoreV1().ConfigMaps("teams-kontrol").Update(configMap)
+	if err != nil {
+		t.Fatalf("failed to update config map: %v", err)
+	}
+	configMap = configMap.DeepCopy()
+	configMap.Data["permissions.yml"] = "verbs: [\"get\"]\nresources: [\"pods\"]\nnamespaces: [\"checkout\"]\n"
+	_, err = client.CoreV1().ConfigMaps("teams-kontrol").Update(configMap)
+	if err != nil {
+		t.Fatalf("failed to update config map: %v", err)
+	}
+	waitForPermissions(t, "get pods checkout", true)
+	waitForPermissions(t, "get pods payments", false)
+}
+
+func TestWatchPermissionsConfigMapInvalid(t *testing.T) {
+	defer watchTestPermissions("teams-kontrol/permissions", "")()
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "permissions", Namespace: "teams-kontrol"},
+		Data:       map[string]string{"other.yml": "verbs: [\"get\"]\n"},
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	err := WatchPermissions(k8s.Clients{Kubernetes: fake.NewSimpleClientset(configMap)}, stop)
+	if err == nil {
+		t.Fatalf("expected an error when the config map doesn't contain the permissions")
+	}
+}
+
+func TestWatchPermissionsConfigMapMissing(t *testing.T) {
+	defer watchTestPermissions("teams-kontrol/permissions", "")()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	err := WatchPermissions(k8s.Clients{Kubernetes: fake.NewSimpleClientset()}, stop)
+	if err == nil {
+		t.Fatalf("expected an error when the config map doesn't exist")
+	}
+}
+
+func TestWatchPermissionsPolicy(t *testing.T) {
+	defer watchTestPermissions("", "teams-kontrol/chat")()
+
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "teams-kontrol.io/v1alpha1",
+		"kind":       "KontrolPolicy",
+		"metadata": map[string]interface{}{
+			"name":      "chat",
+			"namespace": "teams-kontrol",
+		},
+		"spec": map[string]interface{}{
+			"verbs":      []interface{}{"get"},
+			"resources":  []interface{}{"pods"},
+			"namespaces": []interface{}{"team-a-*"},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), policy)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	err := WatchPermissions(k8s.Clients{Dynamic: client}, stop)
+	if err != nil {
+		t.Fatalf("failed to watch permissions: %v", err)
+	}
+	waitForPermissions(t, "get pods team-a-dev", true)
+
+	policy = policy.DeepCopy()
+	policy.Object["spec"].(map[string]interface{})["namespaces"] = []interface{}{"team-b-*"}
+	_, err = client.Resource(k8s.KontrolPolicyResource).Namespace("teams-kontrol").Update(policy, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("failed to update policy: %v", err)
+	}
+	waitForPermissions(t, "get pods team-b-dev", true)
+	waitForPermissions(t, "get pods team-a-dev", false)
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern matches namespaces and resource names in rules.
+// A pattern written between slashes is an anchored regular expression, i.e. /team-a-(dev|staging)/
+// otherwise it's a glob where * matches any characters and ? matches a single character, i.e. team-a-*
+// Matching ignores case.
+type Pattern struct {
+	raw    string
+	regexp *regexp.Regexp
+}
+
+// NewPattern compiles the given glob or regular expression
+func NewPattern(raw string) (Pattern, error) {
+	var expr string
+	if len(raw) >= 2 && strings.HasPrefix(raw, "/") && strings.HasSuffix(raw, "/") {
+		expr = raw[1 : len(raw)-1]
+		if expr == "" {
+			return Pattern{}, errors.New(fmt.Sprintf("invalid pattern %s: empty regular expression", raw))
+		}
+	} else {
+		expr = globToRegexp(raw)
+	}
+	compiled, err := regexp.Compile("(?i)^(?:" + expr + ")$")
+	if err != nil {
+		return Pattern{}, errors.New(fmt.Sprintf("invalid pattern %s: %v", raw, err))
+	}
+	return Pattern{raw: raw, regexp: compiled}, nil
+}
+
+// globToRegexp converts a glob into the equivalent regular expression
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return expr.String()
+}
+
+// UnmarshalYAML compiles the pattern when the permissions are loaded so that invalid patterns are rejected up front
+func (p *Pattern) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	pattern, err := NewPattern(raw)
+	if err != nil {
+		return err
+	}
+	*p = pattern
+	return nil
+}
+
+// MarshalYAML writes the pattern as it was originally given
+func (p Pattern) MarshalYAML() (interface{}, error) {
+	return p.raw, nil
+}
+
+// Matches returns whether the value matches the pattern
+func (p Pattern) Matches(value string) bool {
+	return p.regexp != nil && p.regexp.MatchString(value)
+}
+
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// Patterns is a list of patterns that matches a value when any of its patterns do
+type Patterns []Pattern
+
+// Matches returns whether any of the patterns match the value
+func (p Patterns) Matches(value string) bool {
+	for _, pattern := range p {
+		if pattern.Matches(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,211 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"time"
+)
+
+// Permissions defines what can be executed.
+// The verbs, resources and namespaces at the top level are combined into a rule that applies to everyone.
 type Permissions struct {
-	Verbs      []string `yaml:"verbs"`
-	Resources  []string `yaml:"resources"`
-	Namespaces []string `yaml:"namespaces"`
+	Verbs         []string      `yaml:"verbs"`
+	Resources     []string      `yaml:"resources"`
+	Namespaces    Patterns      `yaml:"namespaces"`
+	Selectors     Selectors     `yaml:"selectors"`
+	Rules         []Rule        `yaml:"rules"`
+	Impersonation Impersonation `yaml:"impersonation"`
+	AccessReview  bool          `yaml:"accessReview"` // check with the API server that RBAC allows each command before executing it
+	Approval      Approval      `yaml:"approval"`
+	Elevation     Elevation     `yaml:"elevation"`
+}
+
+// Approval lists the protected namespaces where commands that change the cluster must be approved by a second user
+type Approval struct {
+	Namespaces Patterns `yaml:"namespaces"`
+}
+
+// Selectors lists the label keys and fields that can be used to filter list commands
+type Selectors struct {
+	Labels []string `yaml:"labels"`
+	Fields []string `yaml:"fields"`
+}
+
+// Rule allows, or denies if Deny is set, every combination of its verbs, resources, namespaces and resource names.
+// When resource names are given the rule only matches commands for those names, so it never matches a list.
+// "*" matches any verb or resource. Namespaces and resource names are patterns, see Pattern.
+// A rule applies to its subjects when the command is sent from one of its teams or channels.
+// Subjects, teams and channels are optional but at least one of them must be specified.
+type Rule struct {
+	Subjects      []Subject `yaml:"subjects"`
+	Teams         []string  `yaml:"teams"`
+	Channels      []string  `yaml:"channels"`
+	Verbs         []string  `yaml:"verbs"`
+	Resources     []string  `yaml:"resources"`
+	Namespaces    Patterns  `yaml:"namespaces"`
+	ResourceNames Patterns  `yaml:"resourceNames"`
+	Deny          bool      `yaml:"deny"`
+}
+
+// Elevation lists the roles that users can temporarily elevate to during an incident
+type Elevation struct {
+	Roles []ElevatedRole `yaml:"roles"`
+}
+
+// ElevatedRole grants its rule to a user that elevates to it for up to MaxDuration.
+// The subjects, teams and channels of the rule are who can elevate to the role rather than who it applies to.
+// When RequireApproval is set one of the approvers must approve the elevation first.
+type ElevatedRole struct {
+	Name            string        `yaml:"name"`
+	MaxDuration     time.Duration `yaml:"maxDuration"`
+	RequireApproval bool          `yaml:"requireApproval"`
+	Approvers       []Subject     `yaml:"approvers"`
+	Rule            `yaml:",inline"`
+}
+
+// Role returns the elevated role with the given name
+func (e Elevation) Role(name string) (ElevatedRole, bool) {
+	for _, role := range e.Roles {
+		if strings.EqualFold(role.Name, name) {
+			return role, true
+		}
+	}
+	return ElevatedRole{}, false
+}
+
+// Impersonation maps teams users to the kubernetes user and groups that their commands are executed as.
+// When enabled, commands from users without a mapping are rejected.
+type Impersonation struct {
+	Enabled bool               `yaml:"enabled"`
+	Users   []ImpersonatedUser `yaml:"users"`
+}
+
+// ImpersonatedUser is the kubernetes user and groups that the teams user identified by the subject is mapped to
+type ImpersonatedUser struct {
+	Subject  `yaml:",inline"`
+	Username string   `yaml:"username"`
+	Groups   []string `yaml:"groups"`
+}
+
+// UserFor returns the kubernetes user that the teams user is mapped to.
+// Mappings by AAD object ID take precedence over mappings by name.
+func (i Impersonation) UserFor(aadObjectID string, name string) (ImpersonatedUser, bool) {
+	for _, user := range i.Users {
+		if user.AADObjectID != "" && user.Matches(aadObjectID, name) {
+			return user, true
+		}
+	}
+	for _, user := range i.Users {
+		if user.Matches(aadObjectID, name) {
+			return user, true
+		}
+	}
+	return ImpersonatedUser{}, false
+}
+
+// Wildcard matches any value in a rule
+const Wildcard = "*"
+
+// Subject identifies a teams user by their AAD object ID or their display name.
+// The AAD object ID should be preferred as display names aren't unique.
+type Subject struct {
+	AADObjectID string `yaml:"aadObjectId"`
+	Name        string `yaml:"name"`
+}
+
+// Matches returns whether the subject identifies the user with the given AAD object ID and name
+func (s Subject) Matches(aadObjectID string, name string) bool {
+	if s.AADObjectID != "" {
+		return strings.EqualFold(s.AADObjectID, aadObjectID)
+	}
+	return s.Name != "" && strings.EqualFold(s.Name, name)
+}
+
+// EveryoneRule returns the rule made up of the verbs, resources and namespaces at the top level
+func (p Permissions) EveryoneRule() Rule {
+	return Rule{
+		Verbs:      p.Verbs,
+		Resources:  p.Resources,
+		Namespaces: p.Namespaces,
+	}
+}
+
+// Validate ensures that every rule is scoped to subjects, teams or channels and describes what it matches
+func (p Permissions) Validate() error {
+	for i, rule := range p.Rules {
+		err := rule.validate(fmt.Sprintf("rule %d", i))
+		if err != nil {
+			return err
+		}
+	}
+	for i, user := range p.Impersonation.Users {
+		if user.AADObjectID == "" && user.Name == "" {
+			return errors.New(fmt.Sprintf("impersonated user %d must specify an aadObjectId or name", i))
+		}
+		if user.Username == "" {
+			return errors.New(fmt.Sprintf("impersonated user %d must specify a username", i))
+		}
+	}
+	names := map[string]bool{}
+	for i, role := range p.Elevation.Roles {
+		if role.Name == "" {
+			return errors.New(fmt.Sprintf("elevated role %d must specify a name", i))
+		}
+		if names[role.Name] {
+			return errors.New(fmt.Sprintf("elevated role %s is defined more than once", role.Name))
+		}
+		names[role.Name] = true
+		if role.MaxDuration <= 0 {
+			return errors.New(fmt.Sprintf("elevated role %s must specify a maxDuration", role.Name))
+		}
+		if role.Deny {
+			return errors.New(fmt.Sprintf("elevated role %s can't deny", role.Name))
+		}
+		if role.RequireApproval && len(role.Approvers) == 0 {
+			return errors.New(fmt.Sprintf("elevated role %s requires approval but has no approvers", role.Name))
+		}
+		for j, approver := range role.Approvers {
+			if approver.AADObjectID == "" && approver.Name == "" {
+				return errors.New(fmt.Sprintf("approver %d of elevated role %s must specify an aadObjectId or name", j, role.Name))
+			}
+		}
+		err := role.Rule.validate("elevated role " + role.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate ensures that the rule is scoped to subjects, teams or channels and describes what it matches
+// name identifies the rule in errors
+func (r Rule) validate(name string) error {
+	if len(r.Subjects) == 0 && len(r.Teams) == 0 && len(r.Channels) == 0 {
+		return errors.New(fmt.Sprintf("%s has no subjects, teams or channels", name))
+	}
+	if len(r.Verbs) == 0 || len(r.Resources) == 0 || len(r.Namespaces) == 0 {
+		return errors.New(fmt.Sprintf("%s must specify verbs, resources and namespaces", name))
+	}
+	for j, subject := range r.Subjects {
+		if subject.AADObjectID == "" && subject.Name == "" {
+			return errors.New(fmt.Sprintf("subject %d of %s must specify an aadObjectId or name", j, name))
+		}
+	}
+	return nil
+}
+
+// Parse unmarshals and validates permissions from YAML
+func Parse(data []byte) (Permissions, error) {
+	var p Permissions
+	err := yaml.Unmarshal(data, &p)
+	if err != nil {
+		return Permissions{}, errors.New(fmt.Sprintf("failed to unmarshal permissions: %v", err))
+	}
+	err = p.Validate()
+	if err != nil {
+		return Permissions{}, errors.New(fmt.Sprintf("invalid permissions: %v", err))
+	}
+	return p, nil
 }
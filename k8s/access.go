@@ -0,0 +1,40 @@
+package k8s
+
+import (
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AccessReview is the outcome of a SubjectAccessReview or SelfSubjectAccessReview
+type AccessReview struct {
+	Allowed bool
+	Reason  string
+}
+
+// ReviewSelfAccess asks the API server whether the user of the client can perform the action
+func ReviewSelfAccess(client kubernetes.Interface, attributes authorizationv1.ResourceAttributes) (*AccessReview, error) {
+	review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AccessReview{Allowed: review.Status.Allowed, Reason: review.Status.Reason}, nil
+}
+
+// ReviewSubjectAccess asks the API server whether the given user and groups can perform the action
+func ReviewSubjectAccess(client kubernetes.Interface, username string, groups []string, attributes authorizationv1.ResourceAttributes) (*AccessReview, error) {
+	review, err := client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               username,
+			Groups:             groups,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AccessReview{Allowed: review.Status.Allowed, Reason: review.Status.Reason}, nil
+}
@@ -1,8 +1,10 @@
 package k8s
 
 import (
+	"errors"
 	"flag"
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -11,6 +13,32 @@ import (
 )
 
 var Client *kubernetes.Clientset
+var DynamicClient dynamic.Interface
+var DefaultMapper *Mapper
+
+// Config is the rest config the clients were created with
+var Config *rest.Config
+
+// Clients holds the typed client used for resources with specific support and
+// the dynamic client used for any other resource resolved through discovery with the mapper
+type Clients struct {
+	Kubernetes kubernetes.Interface
+	Dynamic    dynamic.Interface
+	Mapper     *Mapper
+}
+
+// DefaultClients returns the clients created by CreateClient
+// no clients are returned before CreateClient so that they can be checked against nil
+func DefaultClients() Clients {
+	if Client == nil {
+		return Clients{}
+	}
+	return Clients{
+		Kubernetes: Client,
+		Dynamic:    DynamicClient,
+		Mapper:     DefaultMapper,
+	}
+}
 
 func CreateClient() (err error) {
 
@@ -35,12 +63,47 @@ func CreateClient() (err error) {
 		}
 	}
 
+	Config = config
 	Client, err = kubernetes.NewForConfig(config)
 	if err != nil {
 		return err
 	}
 
+	DynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	DefaultMapper = NewMapper(Client.Discovery())
+
 	logrus.Info("Successfully loaded kube config")
 	return nil
 
 }
+
+// ImpersonatedClients returns clients that send every request as the given kubernetes user and groups
+// so that the user's RBAC permissions apply and the API server's audit log records the user
+func ImpersonatedClients(username string, groups []string) (Clients, error) {
+	if Config == nil {
+		return Clients{}, errors.New("failed to impersonate user: kube config has not been loaded")
+	}
+	config := rest.CopyConfig(Config)
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: username,
+		Groups:   groups,
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return Clients{}, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return Clients{}, err
+	}
+	// the resources available through discovery are the same for every user so the default mapper's cache is shared
+	return Clients{
+		Kubernetes: client,
+		Dynamic:    dynamicClient,
+		Mapper:     DefaultMapper,
+	}, nil
+}
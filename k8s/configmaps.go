@@ -0,0 +1,59 @@
+package k8s
+
+import (
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// GetConfigMapData returns the data of the config map or no data if it doesn't exist
+func GetConfigMapData(client kubernetes.Interface, namespace string, name string) (map[string]string, error) {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return configMap.Data, nil
+}
+
+// UpdateConfigMapData applies update to the data of the config map, creating the config map if it doesn't exist.
+// update is retried with the latest data when the config map is modified concurrently so it must not have side effects.
+// The config map is only written when update returns true.
+func UpdateConfigMapData(client kubernetes.Interface, namespace string, name string, update func(data map[string]string) (bool, error)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMaps := client.CoreV1().ConfigMaps(namespace)
+		configMap, err := configMaps.Get(name, metav1.GetOptions{})
+		exists := !apierrors.IsNotFound(err)
+		if !exists {
+			configMap = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			}
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+
+		changed, err := update(configMap.Data)
+		if err != nil || !changed {
+			return err
+		}
+		if !exists {
+			_, err = configMaps.Create(configMap)
+			if apierrors.IsAlreadyExists(err) {
+				// created concurrently, retry against the existing config map
+				return apierrors.NewConflict(v1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+}
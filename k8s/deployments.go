@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"encoding/json"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// RestartedAtAnnotation is set on the pod template to trigger a rollout, the same as kubectl rollout restart
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// DeploymentScale holds a deployment after it's been scaled and the number of replicas it had before
+type DeploymentScale struct {
+	Deployment       *appsv1.Deployment
+	PreviousReplicas int32
+}
+
+// DeploymentRestart holds a deployment after a rollout restart was triggered
+type DeploymentRestart struct {
+	Deployment  *appsv1.Deployment
+	RestartedAt time.Time
+}
+
+func GetDeployments(client kubernetes.Interface, namespace string, opts metav1.ListOptions) (interface{}, error) {
+	return client.AppsV1().Deployments(namespace).List(opts)
+}
+
+func GetDeployment(client kubernetes.Interface, namespace string, name string) (interface{}, error) {
+	return client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+}
+
+func ScaleDeployment(client kubernetes.Interface, namespace string, name string, replicas int32) (interface{}, error) {
+	deployment, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var previousReplicas int32 = 1 // replicas defaults to 1 when not specified
+	if deployment.Spec.Replicas != nil {
+		previousReplicas = *deployment.Spec.Replicas
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err = client.AppsV1().Deployments(namespace).Patch(name, types.StrategicMergePatchType, patch)
+	if err != nil {
+		return nil, err
+	}
+	return &DeploymentScale{
+		Deployment:       deployment,
+		PreviousReplicas: previousReplicas,
+	}, nil
+}
+
+// RestartDeployment triggers a rollout by patching the restartedAt annotation of the pod template
+func RestartDeployment(client kubernetes.Interface, namespace string, name string) (interface{}, error) {
+	restartedAt := time.Now()
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						RestartedAtAnnotation: restartedAt.Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err := client.AppsV1().Deployments(namespace).Patch(name, types.StrategicMergePatchType, patch)
+	if err != nil {
+		return nil, err
+	}
+	return &DeploymentRestart{
+		Deployment:  deployment,
+		RestartedAt: restartedAt,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+)
+
+// maxDescribeEvents is the number of most recent events included when describing an object
+const maxDescribeEvents = 10
+
+// PodDescription holds a pod along with the most recent events for it
+type PodDescription struct {
+	Pod    *v1.Pod
+	Events []v1.Event
+}
+
+func DescribePod(client kubernetes.Interface, namespace string, name string) (interface{}, error) {
+	pod, err := client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := GetEventsFor(client, namespace, "Pod", pod.Name, string(pod.UID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PodDescription{
+		Pod:    pod,
+		Events: events,
+	}, nil
+}
+
+// GetEventsFor returns the most recent events for the object, newest first
+func GetEventsFor(client kubernetes.Interface, namespace string, kind string, name string, uid string) ([]v1.Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": kind,
+		"involvedObject.name": name,
+	}
+	if uid != "" {
+		selector["involvedObject.uid"] = uid
+	}
+
+	eventList, err := client.CoreV1().Events(namespace).List(metav1.ListOptions{
+		FieldSelector: selector.AsSelector().String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := eventList.Items
+	sort.SliceStable(events, func(i, j int) bool {
+		return EventTime(events[i]).After(EventTime(events[j]).Time)
+	})
+	if len(events) > maxDescribeEvents {
+		events = events[:maxDescribeEvents]
+	}
+	return events, nil
+}
+
+// EventTime returns the last time the event was seen falling back to when it was first seen or created
+func EventTime(event v1.Event) metav1.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp
+	case !event.EventTime.IsZero():
+		return metav1.NewTime(event.EventTime.Time)
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp
+	default:
+		return event.CreationTimestamp
+	}
+}
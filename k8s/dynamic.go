@@ -0,0 +1,91 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// Mapper resolves resources through a discovery client that caches the API resources of the cluster.
+// The cache is refreshed when a resource can't be found so that newly installed custom resources are picked up.
+type Mapper struct {
+	deferred *restmapper.DeferredDiscoveryRESTMapper
+	mapper   meta.RESTMapper
+}
+
+// NewMapper returns a mapper that caches the result of discovery until a resource can't be found
+func NewMapper(client discovery.DiscoveryInterface) *Mapper {
+	cached := memory.NewMemCacheClient(client)
+	deferred := restmapper.NewDeferredDiscoveryRESTMapper(cached)
+	return &Mapper{
+		deferred: deferred,
+		mapper:   restmapper.NewShortcutExpander(deferred, cached),
+	}
+}
+
+// ResolveResource resolves a resource name, short name or plural to its REST mapping through discovery.
+// The resource can be qualified with its group to disambiguate it. i.e. certificates.cert-manager.io
+// Only namespaced resources are supported as every command is scoped to a namespace.
+// Discovery is cached by the mapper of the clients, clients without one run discovery on every call.
+func ResolveResource(clients Clients, resource string) (*meta.RESTMapping, error) {
+	mapper := clients.Mapper
+	if mapper == nil {
+		mapper = NewMapper(clients.Kubernetes.Discovery())
+	}
+
+	mapping, err := mapper.resolve(resource)
+	if meta.IsNoMatchError(err) {
+		// the resource may have been installed since discovery was cached
+		mapper.deferred.Reset()
+		mapping, err = mapper.resolve(resource)
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unknown resource %s: %v", resource, err))
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return nil, errors.New(fmt.Sprintf("resource %s is not namespaced, only namespaced resources are supported", resource))
+	}
+	return mapping, nil
+}
+
+func (m *Mapper) resolve(resource string) (*meta.RESTMapping, error) {
+	gvr, err := m.mapper.ResourceFor(schema.ParseGroupResource(resource).WithVersion(""))
+	if err != nil {
+		return nil, err
+	}
+	gvk, err := m.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+	return m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+func GetResources(clients Clients, resource string, namespace string, opts metav1.ListOptions) (interface{}, error) {
+	mapping, err := ResolveResource(clients, resource)
+	if err != nil {
+		return nil, err
+	}
+	return clients.Dynamic.Resource(mapping.Resource).Namespace(namespace).List(opts)
+}
+
+func GetResource(clients Clients, resource string, namespace string, name string) (interface{}, error) {
+	mapping, err := ResolveResource(clients, resource)
+	if err != nil {
+		return nil, err
+	}
+	return clients.Dynamic.Resource(mapping.Resource).Namespace(namespace).Get(name, metav1.GetOptions{})
+}
+
+func DeleteResource(clients Clients, resource string, namespace string, name string) error {
+	mapping, err := ResolveResource(clients, resource)
+	if err != nil {
+		return err
+	}
+	return clients.Dynamic.Resource(mapping.Resource).Namespace(namespace).Delete(name, &metav1.DeleteOptions{})
+}
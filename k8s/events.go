@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+const ActionEventReason = "TeamsKontrolAction"
+const LastActionByAnnotation = "teams-kontrol/last-action-by"
+const eventSourceComponent = "teams-kontrol"
+
+// RecordActionEvent creates a normal event on the object describing an action taken from teams
+// the event is created in the namespace of the object so that it's shown by kubectl get events and kubectl describe
+func RecordActionEvent(client kubernetes.Interface, object v1.ObjectReference, message string) (*v1.Event, error) {
+	now := metav1.NewTime(time.Now())
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// named the same way as the events created by the client-go event recorder
+			Name:      fmt.Sprintf("%v.%x", object.Name, now.UnixNano()),
+			Namespace: object.Namespace,
+		},
+		InvolvedObject: object,
+		Reason:         ActionEventReason,
+		Message:        message,
+		Type:           v1.EventTypeNormal,
+		Source:         v1.EventSource{Component: eventSourceComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	return client.CoreV1().Events(object.Namespace).Create(event)
+}
+
+// AnnotateDeployment sets an annotation on the deployment without changing its pod template so that it doesn't trigger a rollout
+func AnnotateDeployment(client kubernetes.Interface, namespace string, name string, key string, value string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				key: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.AppsV1().Deployments(namespace).Patch(name, types.StrategicMergePatchType, patch)
+	return err
+}
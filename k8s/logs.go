@@ -0,0 +1,29 @@
+package k8s
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodLogs holds the logs retrieved for a container in a pod
+type PodLogs struct {
+	Namespace string
+	Name      string
+	Container string
+	Previous  bool
+	Logs      string
+}
+
+func GetPodLogs(client kubernetes.Interface, namespace string, name string, opts *v1.PodLogOptions) (interface{}, error) {
+	logs, err := client.CoreV1().Pods(namespace).GetLogs(name, opts).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	return &PodLogs{
+		Namespace: namespace,
+		Name:      name,
+		Container: opts.Container,
+		Previous:  opts.Previous,
+		Logs:      string(logs),
+	}, nil
+}
@@ -3,8 +3,8 @@ package k8s
 import "k8s.io/client-go/kubernetes"
 import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-func GetPods(client kubernetes.Interface, namespace string) (interface{}, error) {
-	return client.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+func GetPods(client kubernetes.Interface, namespace string, opts metav1.ListOptions) (interface{}, error) {
+	return client.CoreV1().Pods(namespace).List(opts)
 }
 
 func GetPod(client kubernetes.Interface, namespace string, name string) (interface{}, error) {
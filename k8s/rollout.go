@@ -0,0 +1,230 @@
+package k8s
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strconv"
+)
+
+const RevisionAnnotation = "deployment.kubernetes.io/revision"
+const ChangeCauseAnnotation = "kubernetes.io/change-cause"
+
+// podTemplateHashLabel is added to the pod template of each replica set and must be removed when rolling back
+const podTemplateHashLabel = "pod-template-hash"
+
+// DeploymentRolloutStatus holds a deployment and a description of the progress of its rollout
+type DeploymentRolloutStatus struct {
+	Deployment *appsv1.Deployment
+	Complete   bool
+	Message    string
+}
+
+// DeploymentRevision describes the pod template of a deployment at a revision
+type DeploymentRevision struct {
+	Revision    int64
+	ChangeCause string
+	Images      []string
+	Created     metav1.Time
+}
+
+// DeploymentHistory holds a deployment and its revisions, oldest first
+type DeploymentHistory struct {
+	Deployment *appsv1.Deployment
+	Revisions  []DeploymentRevision
+}
+
+// DeploymentRollback holds a deployment after it's been rolled back along with the images before the roll back
+type DeploymentRollback struct {
+	Deployment     *appsv1.Deployment
+	FromRevision   int64
+	ToRevision     int64
+	PreviousImages []string
+	Images         []string
+}
+
+// GetRolloutStatus describes the progress of a deployment rollout the same way as kubectl rollout status
+func GetRolloutStatus(client kubernetes.Interface, namespace string, name string) (interface{}, error) {
+	deployment, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	complete, message := rolloutStatus(deployment)
+	return &DeploymentRolloutStatus{
+		Deployment: deployment,
+		Complete:   complete,
+		Message:    message,
+	}, nil
+}
+
+func rolloutStatus(deployment *appsv1.Deployment) (bool, string) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return false, "Waiting for deployment spec update to be observed"
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return false, fmt.Sprintf("deployment %q exceeded its progress deadline", deployment.Name)
+		}
+	}
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	switch {
+	case status.UpdatedReplicas < desired:
+		return false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated",
+			deployment.Name, status.UpdatedReplicas, desired)
+	case status.Replicas > status.UpdatedReplicas:
+		return false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination",
+			deployment.Name, status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available",
+			deployment.Name, status.AvailableReplicas, status.UpdatedReplicas)
+	default:
+		return true, fmt.Sprintf("deployment %q successfully rolled out", deployment.Name)
+	}
+}
+
+// GetRolloutHistory returns the revisions of the deployment from the replica sets it owns
+func GetRolloutHistory(client kubernetes.Interface, namespace string, name string) (interface{}, error) {
+	deployment, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets, err := ownedReplicaSets(client, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &DeploymentHistory{Deployment: deployment}
+	for _, replicaSet := range replicaSets {
+		history.Revisions = append(history.Revisions, DeploymentRevision{
+			Revision:    revision(replicaSet.ObjectMeta),
+			ChangeCause: replicaSet.Annotations[ChangeCauseAnnotation],
+			Images:      images(replicaSet.Spec.Template.Spec),
+			Created:     replicaSet.CreationTimestamp,
+		})
+	}
+	return history, nil
+}
+
+// RolloutUndo rolls the deployment back to the pod template of the given revision the same way as kubectl rollout undo
+// if toRevision is 0 then the deployment is rolled back to the previous revision
+func RolloutUndo(client kubernetes.Interface, namespace string, name string, toRevision int64) (interface{}, error) {
+	deployment, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if deployment.Spec.Paused {
+		return nil, errors.New("you cannot rollback a paused deployment; resume it first and try again")
+	}
+
+	replicaSets, err := ownedReplicaSets(client, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	currentRevision := revision(deployment.ObjectMeta)
+	var target *appsv1.ReplicaSet
+	if toRevision == 0 {
+		// the previous revision is the highest revision that isn't the current one
+		for i := len(replicaSets) - 1; i >= 0; i-- {
+			if revision(replicaSets[i].ObjectMeta) != currentRevision {
+				target = &replicaSets[i]
+				break
+			}
+		}
+		if target == nil {
+			return nil, errors.New("no rollout history found for deployment " + name)
+		}
+	} else {
+		for i := range replicaSets {
+			if revision(replicaSets[i].ObjectMeta) == toRevision {
+				target = &replicaSets[i]
+				break
+			}
+		}
+		if target == nil {
+			return nil, errors.New(fmt.Sprintf("unable to find specified revision %d in history", toRevision))
+		}
+	}
+
+	template := target.Spec.Template.DeepCopy()
+	delete(template.Labels, podTemplateHashLabel)
+
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "replace", "path": "/spec/template", "value": template},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	previousImages := images(deployment.Spec.Template.Spec)
+	deployment, err = client.AppsV1().Deployments(namespace).Patch(name, types.JSONPatchType, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeploymentRollback{
+		Deployment:     deployment,
+		FromRevision:   currentRevision,
+		ToRevision:     revision(target.ObjectMeta),
+		PreviousImages: previousImages,
+		Images:         images(deployment.Spec.Template.Spec),
+	}, nil
+}
+
+// ownedReplicaSets returns the replica sets controlled by the deployment sorted by revision
+func ownedReplicaSets(client kubernetes.Interface, deployment *appsv1.Deployment) ([]appsv1.ReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSetList, err := client.AppsV1().ReplicaSets(deployment.Namespace).List(metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var replicaSets []appsv1.ReplicaSet
+	for _, replicaSet := range replicaSetList.Items {
+		controllerRef := metav1.GetControllerOf(&replicaSet)
+		if controllerRef != nil && controllerRef.UID == deployment.UID {
+			replicaSets = append(replicaSets, replicaSet)
+		}
+	}
+	sort.SliceStable(replicaSets, func(i, j int) bool {
+		return revision(replicaSets[i].ObjectMeta) < revision(replicaSets[j].ObjectMeta)
+	})
+	return replicaSets, nil
+}
+
+// revision returns the revision annotation of the object or 0 if it's not set
+func revision(meta metav1.ObjectMeta) int64 {
+	value, err := strconv.ParseInt(meta.Annotations[RevisionAnnotation], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func images(spec v1.PodSpec) []string {
+	var images []string
+	for _, container := range spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
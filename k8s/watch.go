@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// KontrolPolicyResource is the custom resource that permissions can be loaded from
+var KontrolPolicyResource = schema.GroupVersionResource{
+	Group:    "teams-kontrol.io",
+	Version:  "v1alpha1",
+	Resource: "kontrolpolicies",
+}
+
+// WatchConfigMap calls onUpdate with the named config map whenever it's added or updated until stop is closed.
+// It waits for the config map to be synced and returns an error if it doesn't exist or the initial onUpdate fails.
+func WatchConfigMap(clients Clients, namespace string, name string, onUpdate func(*v1.ConfigMap) error, stop <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(clients.Kubernetes, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(nameFieldSelector(name)))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if configMap, ok := obj.(*v1.ConfigMap); ok {
+				_ = onUpdate(configMap) // failures are reported by onUpdate
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if configMap, ok := obj.(*v1.ConfigMap); ok {
+				_ = onUpdate(configMap) // failures are reported by onUpdate
+			}
+		},
+	})
+
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
+		return errors.New(fmt.Sprintf("failed to sync config map %s/%s", namespace, name))
+	}
+
+	// event handlers are called asynchronously so the initial state is loaded directly from the informer's store
+	obj, exists, err := informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return err
+	}
+	configMap, ok := obj.(*v1.ConfigMap)
+	if !exists || !ok {
+		return errors.New(fmt.Sprintf("config map %s/%s not found", namespace, name))
+	}
+	return onUpdate(configMap)
+}
+
+// WatchKontrolPolicy calls onUpdate with the named KontrolPolicy whenever it's added or updated until stop is closed.
+// It waits for the policy to be synced and returns an error if it doesn't exist or the initial onUpdate fails.
+func WatchKontrolPolicy(clients Clients, namespace string, name string, onUpdate func(*unstructured.Unstructured) error, stop <-chan struct{}) error {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(clients.Dynamic, 0, namespace, nameFieldSelector(name))
+	informer := factory.ForResource(KontrolPolicyResource).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if policy, ok := obj.(*unstructured.Unstructured); ok {
+				_ = onUpdate(policy) // failures are reported by onUpdate
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if policy, ok := obj.(*unstructured.Unstructured); ok {
+				_ = onUpdate(policy) // failures are reported by onUpdate
+			}
+		},
+	})
+
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
+		return errors.New(fmt.Sprintf("failed to sync %s %s/%s", KontrolPolicyResource.Resource, namespace, name))
+	}
+
+	// event handlers are called asynchronously so the initial state is loaded directly from the informer's store
+	obj, exists, err := informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return err
+	}
+	policy, ok := obj.(*unstructured.Unstructured)
+	if !exists || !ok {
+		return errors.New(fmt.Sprintf("%s %s/%s not found", KontrolPolicyResource.Resource, namespace, name))
+	}
+	return onUpdate(policy)
+}
+
+// nameFieldSelector restricts an informer to the object with the given name
+func nameFieldSelector(name string) func(*metav1.ListOptions) {
+	return func(opts *metav1.ListOptions) {
+		opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	}
+}
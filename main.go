@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"expvar"
+	"github.com/daniel-cole/teams-kontrol/audit"
 	"github.com/daniel-cole/teams-kontrol/command"
 	"github.com/daniel-cole/teams-kontrol/healthz"
 	"github.com/daniel-cole/teams-kontrol/k8s"
@@ -17,7 +19,12 @@ import (
 func main() {
 	setupLogging()
 
-	err := k8s.CreateClient()
+	err := audit.Init()
+	if err != nil {
+		logrus.Fatalf("failed to initialise audit sinks: %v", err)
+	}
+
+	err = k8s.CreateClient()
 	if err != nil {
 		logrus.Fatalf("failed to create k8s client %v", err)
 	}
@@ -26,18 +33,33 @@ func main() {
 	teams.Init()
 	command.Init()
 
+	stopWatching := make(chan struct{})
+	err = command.WatchPermissions(k8s.DefaultClients(), stopWatching)
+	if err != nil {
+		logrus.Fatalf("failed to watch permissions: %v", err)
+	}
+	err = command.InitApprovalStore(k8s.DefaultClients())
+	if err != nil {
+		logrus.Fatalf("failed to initialise approval store: %v", err)
+	}
+
 	//  add handlers
+	// a mux is used rather than http.DefaultServeMux as importing expvar registers /debug/vars on the default mux
+	mux := http.NewServeMux()
 	healthzHandler := http.HandlerFunc(healthz.Handler)
-	http.Handle("/healthz", middleware.Logger(healthzHandler))
-	http.Handle("/teams", middleware.Logger(teams.AuthHandler(http.HandlerFunc(teams.MessageHandler))))
+	mux.Handle("/healthz", middleware.Logger(healthzHandler))
+	mux.Handle("/teams", middleware.Logger(teams.AuthHandler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			teams.MessageHandler(k8s.DefaultClients(), w, r)
+		}))))
 
 	// only load /command endpoint if specified in environment variable
 	// this handler is insecure and should not be loaded in production if you are exposing it externally
 	if os.Getenv(command.KontrolInsecureCommandHandlerEnvKey) == "TRUE" {
 		logrus.Warnf("Detected %s set to 'TRUE'. Loading insecure command endpoint on /command", command.KontrolInsecureCommandHandlerEnvKey)
-		http.Handle("/command", middleware.Logger(
+		mux.Handle("/command", middleware.Logger(
 			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				command.Handler(k8s.Client, w, r)
+				command.Handler(k8s.DefaultClients(), w, r)
 			})))
 	}
 
@@ -45,6 +67,7 @@ func main() {
 
 	server := &http.Server{
 		Addr:         listenAddr,
+		Handler:      mux,
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  30 * time.Second,
@@ -57,6 +80,7 @@ func main() {
 
 	go func() {
 		<-quit
+		close(stopWatching)
 		graceTime := 30 * time.Second
 		logrus.Infof("Server is shutting down... grace period: %s", graceTime.String())
 
@@ -70,6 +94,8 @@ func main() {
 		close(done)
 	}()
 
+	serveMetrics()
+
 	tlsCertFile := os.Getenv("TEAMS_KONTROL_TLS_CERT")
 	tlsKeyFile := os.Getenv("TEAMS_KONTROL_TLS_KEY")
 
@@ -111,3 +137,20 @@ func setupLogging() {
 	}
 	logrus.Info("Log level set to: " + logLevel)
 }
+
+// serveMetrics serves the counters published with expvar on /debug/vars when TEAMS_KONTROL_METRICS_ADDR is set.
+// They're kept off the public listener as they include the command line and memory statistics of the process.
+func serveMetrics() {
+	metricsAddr := os.Getenv("TEAMS_KONTROL_METRICS_ADDR")
+	if metricsAddr == "" {
+		return
+	}
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/debug/vars", expvar.Handler())
+	go func() {
+		logrus.Infof("Serving metrics on %s/debug/vars", metricsAddr)
+		if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+			logrus.Errorf("Could not serve metrics on %s: %v", metricsAddr, err)
+		}
+	}()
+}
@@ -0,0 +1,152 @@
+package teams
+
+import (
+	"golang.org/x/net/html"
+	"strings"
+)
+
+const mentionEntityType = "mention"
+const mentionItemType = "http://schema.skype.com/Mention"
+const htmlContentType = "text/html"
+
+// segment is a piece of text from a teams message which is either plain text or a mention
+type segment struct {
+	text    string
+	mention bool
+}
+
+// parseTeamsRequestText returns the command from the text of the request with the mention of the webhook removed.
+// The text is read from the request text when it contains a mention, otherwise from the html attachment.
+// Everything before the webhook mention is discarded, other mentions are replaced with the name of who was mentioned,
+// html entities are decoded and whitespace is collapsed.
+func parseTeamsRequestText(request Request) string {
+	segments := splitMentions(requestRawText(request))
+
+	// the command is everything after the mention of the webhook
+	start := 0
+	if idx := botMentionIndex(segments, botName(request)); idx >= 0 {
+		start = idx + 1
+	}
+
+	var text strings.Builder
+	for _, s := range segments[start:] {
+		text.WriteString(s.text)
+	}
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// requestRawText returns the message as it was sent, which is the html attachment when the text doesn't include the mention
+func requestRawText(request Request) string {
+	if strings.Contains(strings.ToLower(request.Text), "<at>") {
+		return request.Text
+	}
+	for _, attachment := range request.Attachments {
+		if attachment.ContentType == htmlContentType && strings.Contains(attachment.Content, mentionItemType) {
+			return attachment.Content
+		}
+	}
+	return request.Text
+}
+
+// botName returns the name the webhook was mentioned with if it can be determined from the request
+func botName(request Request) string {
+	if request.Recipient.ID != "" {
+		for _, entity := range request.Entities {
+			if entity.Type == mentionEntityType && entity.Mentioned.ID == request.Recipient.ID {
+				return entity.Mentioned.Name
+			}
+		}
+	}
+	return request.Recipient.Name
+}
+
+// botMentionIndex returns the index of the segment that mentions the webhook.
+// If the name of the webhook isn't known, or it's not found, the first mention is presumed to be the webhook.
+// -1 is returned when there are no mentions.
+func botMentionIndex(segments []segment, name string) int {
+	first := -1
+	for i, s := range segments {
+		if !s.mention {
+			continue
+		}
+		if first == -1 {
+			first = i
+		}
+		if name != "" && strings.EqualFold(strings.TrimSpace(s.text), strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return first
+}
+
+// splitMentions tokenizes the text as html and splits it into plain text and mention segments.
+// Mentions are either <at>name</at> in the request text or a span with the skype mention itemtype in the html attachment.
+// Any other tags are treated as whitespace and entities such as &nbsp; are decoded.
+func splitMentions(text string) []segment {
+	var segments []segment
+	var current strings.Builder
+	inMention := false
+	spanDepth := 0 // depth of spans nested within a mention span
+
+	flush := func(mention bool) {
+		if current.Len() > 0 || mention {
+			segments = append(segments, segment{text: current.String(), mention: mention})
+		}
+		current.Reset()
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(text))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken { // io.EOF, the tokenizer doesn't return any other errors for a strings.Reader
+			break
+		}
+
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			current.WriteString(token.Data) // entities such as &nbsp; are already decoded and collapsed later as whitespace
+		case html.StartTagToken:
+			switch {
+			case token.Data == "at" && !inMention:
+				flush(false)
+				inMention = true
+			case token.Data == "span" && inMention:
+				spanDepth++
+			case token.Data == "span" && isMentionSpan(token):
+				flush(false)
+				inMention = true
+			case !inMention:
+				current.WriteString(" ")
+			}
+		case html.EndTagToken:
+			switch {
+			case token.Data == "at" && inMention:
+				flush(true)
+				inMention = false
+			case token.Data == "span" && inMention && spanDepth > 0:
+				spanDepth--
+			case token.Data == "span" && inMention:
+				flush(true)
+				inMention = false
+			case !inMention:
+				current.WriteString(" ")
+			}
+		case html.SelfClosingTagToken:
+			if !inMention {
+				current.WriteString(" ")
+			}
+		}
+	}
+	flush(inMention)
+	return segments
+}
+
+func isMentionSpan(token html.Token) bool {
+	for _, attr := range token.Attr {
+		if attr.Key == "itemtype" && attr.Val == mentionItemType {
+			return true
+		}
+	}
+	return false
+}
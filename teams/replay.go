@@ -0,0 +1,87 @@
+package teams
+
+import (
+	"container/list"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const KontrolReplayWindowEnvKey = "TEAMS_KONTROL_REPLAY_WINDOW"
+const KontrolReplayCacheSizeEnvKey = "TEAMS_KONTROL_REPLAY_CACHE_SIZE"
+const defaultReplayWindow = 5 * time.Minute
+const defaultReplayCacheSize = 10000
+
+// rejectedRequests counts authenticated requests that were rejected as expired, replayed or missing their id or timestamp
+var rejectedRequests = expvar.NewMap("teams_rejected_requests")
+
+var now = time.Now
+
+var replays = newReplayGuard(defaultReplayWindow, defaultReplayCacheSize)
+
+// replayGuard rejects activities with a timestamp outside of the window and activities that have already been seen.
+// The IDs of activities are remembered until they fall outside of the window or the cache is full, in which case the oldest are forgotten first.
+type replayGuard struct {
+	mu     sync.Mutex
+	window time.Duration
+	size   int
+	seen   map[string]*list.Element
+	order  *list.List // seenActivity values ordered from oldest to newest
+}
+
+type seenActivity struct {
+	id   string
+	seen time.Time
+}
+
+func newReplayGuard(window time.Duration, size int) *replayGuard {
+	return &replayGuard{
+		window: window,
+		size:   size,
+		seen:   map[string]*list.Element{},
+		order:  list.New(),
+	}
+}
+
+// check returns an error if the activity should be rejected, otherwise the activity is remembered so that it can't be replayed
+func (g *replayGuard) check(id string, timestamp time.Time) error {
+	if id == "" || timestamp.IsZero() {
+		rejectedRequests.Add("invalid", 1)
+		return errors.New("activity is missing its id or timestamp")
+	}
+
+	current := now()
+	// teams and teams-kontrol clocks may differ so the timestamp is allowed to be ahead by the same window
+	if skew := current.Sub(timestamp); skew > g.window || skew < -g.window {
+		rejectedRequests.Add("expired", 1)
+		return errors.New(fmt.Sprintf("activity %s has timestamp %s outside of the %s window", id, timestamp.Format(time.RFC3339), g.window))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.forgetExpired(current)
+	if _, ok := g.seen[id]; ok {
+		rejectedRequests.Add("replayed", 1)
+		return errors.New(fmt.Sprintf("activity %s has already been received", id))
+	}
+	for g.order.Len() >= g.size {
+		g.forget(g.order.Front())
+	}
+	g.seen[id] = g.order.PushBack(seenActivity{id: id, seen: current})
+	return nil
+}
+
+// forgetExpired removes activities that were seen long enough ago that they'd be rejected by the window anyway
+func (g *replayGuard) forgetExpired(current time.Time) {
+	// a timestamp may be ahead by the window as well so activities are kept for twice as long
+	for e := g.order.Front(); e != nil && current.Sub(e.Value.(seenActivity).seen) > 2*g.window; e = g.order.Front() {
+		g.forget(e)
+	}
+}
+
+func (g *replayGuard) forget(e *list.Element) {
+	delete(g.seen, e.Value.(seenActivity).id)
+	g.order.Remove(e)
+}
@@ -0,0 +1,42 @@
+package teams
+
+import "encoding/json"
+
+const messageActivityType = "message"
+const adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+
+// Response is the message activity returned to teams in reply to an outgoing webhook request
+// See: https://docs.microsoft.com/en-us/microsoftteams/platform/webhooks-and-connectors/how-to/add-outgoing-webhook
+type Response struct {
+	Type        string       `json:"type"`
+	Text        string       `json:"text,omitempty"`
+	Summary     string       `json:"summary,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment holds a card to be rendered inline with the message
+type Attachment struct {
+	ContentType string          `json:"contentType"`
+	Content     json.RawMessage `json:"content"`
+}
+
+// NewTextResponse returns a plain message with the given text
+func NewTextResponse(text string) *Response {
+	return &Response{
+		Type: messageActivityType,
+		Text: text,
+	}
+}
+
+// NewCardResponse returns a message with the given adaptive card attached
+// summary is displayed by teams in notifications and places where the card can't be rendered
+func NewCardResponse(summary string, card []byte) *Response {
+	return &Response{
+		Type:    messageActivityType,
+		Summary: summary,
+		Attachments: []Attachment{{
+			ContentType: adaptiveCardContentType,
+			Content:     card,
+		}},
+	}
+}
@@ -8,12 +8,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/daniel-cole/teams-kontrol/audit"
+	"github.com/daniel-cole/teams-kontrol/command"
+	"github.com/daniel-cole/teams-kontrol/k8s"
 	"github.com/daniel-cole/teams-kontrol/middleware"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -39,7 +42,10 @@ type Request struct {
 		ConversationType string      `json:"conversationType"`
 		TenantID         string      `json:"tenantId"`
 	} `json:"conversation"`
-	Recipient        interface{}   `json:"recipient"`
+	Recipient struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"recipient"`
 	TextFormat       string        `json:"textFormat"`
 	AttachmentLayout interface{}   `json:"attachmentLayout"`
 	MembersAdded     []interface{} `json:"membersAdded"`
@@ -60,10 +66,15 @@ type Request struct {
 		ThumbnailURL interface{} `json:"thumbnailUrl"`
 	} `json:"attachments"`
 	Entities []struct {
-		Type     string `json:"type"`
-		Locale   string `json:"locale"`
-		Country  string `json:"country"`
-		Platform string `json:"platform"`
+		Type      string `json:"type"`
+		Locale    string `json:"locale"`
+		Country   string `json:"country"`
+		Platform  string `json:"platform"`
+		Text      string `json:"text"`
+		Mentioned struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"mentioned"`
 	} `json:"entities"`
 	ChannelData struct {
 		TeamsChannelID string `json:"teamsChannelId"`
@@ -86,30 +97,50 @@ type Request struct {
 	Code      interface{} `json:"code"`
 }
 
-type Response struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+var secret string
+
+// teamID returns the ID of the team the request was sent from
+func (r Request) teamID() string {
+	if r.ChannelData.Team.ID != "" {
+		return r.ChannelData.Team.ID
+	}
+	return r.ChannelData.TeamsTeamID
 }
 
-var secret string
+// channelID returns the ID of the channel the request was sent from
+func (r Request) channelID() string {
+	if r.ChannelData.Channel.ID != "" {
+		return r.ChannelData.Channel.ID
+	}
+	return r.ChannelData.TeamsChannelID
+}
 
 // Init will ensure that there's a valid shared secret. The program will crash if it is not specified.
 func Init() {
 	if secret = os.Getenv(KontrolSharedSecretEnvKey); secret == "" {
 		logrus.Fatalf("Exiting. Please specify a shared secret with: %s", KontrolSharedSecretEnvKey)
 	}
-}
 
-func parseTeamsRequestText(text string) string {
-	r := regexp.MustCompile(`^.*</at> (.*)\n$`)
-	match := r.FindStringSubmatch(text)
-	if match != nil {
-		return match[1]
+	window := defaultReplayWindow
+	if value := os.Getenv(KontrolReplayWindowEnvKey); value != "" {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil || window <= 0 {
+			logrus.Fatalf("Exiting. Invalid %s '%s', expected a positive duration. i.e. 5m", KontrolReplayWindowEnvKey, value)
+		}
 	}
-	return ""
+	size := defaultReplayCacheSize
+	if value := os.Getenv(KontrolReplayCacheSizeEnvKey); value != "" {
+		var err error
+		if size, err = strconv.Atoi(value); err != nil || size <= 0 {
+			logrus.Fatalf("Exiting. Invalid %s '%s', expected a positive number", KontrolReplayCacheSizeEnvKey, value)
+		}
+	}
+	replays = newReplayGuard(window, size)
 }
 
-func MessageHandler(w http.ResponseWriter, r *http.Request) {
+// MessageHandler parses the command from the outgoing teams request, executes it and
+// responds with the result rendered as an adaptive card attachment
+func MessageHandler(clients k8s.Clients, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	if r.Method != http.MethodPost {
@@ -121,27 +152,341 @@ func MessageHandler(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		middleware.LogWithContext(ctx).Errorf("failed to decode request body from teams: %v", err)
-		teamsResponse := &Response{
-			Type: "message",
-			Text: "failed to parse payload from teams",
-		}
 		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(teamsResponse)
+		_ = json.NewEncoder(w).Encode(NewTextResponse("failed to parse payload from teams"))
 		return
 	}
 
 	middleware.LogWithContext(ctx).Infof("Received request from %s", request.From.Name)
-	// here we should parse the text and then attempt to execute the command if it's valid
-	//parsedText := parseTeamsRequestText(request.Text)
 
-	msg := fmt.Sprintf("%s - that command is not available. Please specify a valid command.", request.From.Name)
-	teamsResponse := &Response{
-		Type: "message",
-		Text: msg,
+	parsedText := parseTeamsRequestText(request)
+	requester := command.Requester{
+		AADObjectID: request.From.AadObjectID,
+		Name:        request.From.Name,
+		TeamID:      request.teamID(),
+		ChannelID:   request.channelID(),
+	}
+
+	event := audit.NewEvent(ctx, audit.CommandEvent)
+	event.User = requester.Name
+	event.AADObjectID = requester.AADObjectID
+	event.TeamID = requester.TeamID
+	event.ChannelID = requester.ChannelID
+	event.RawText = requestRawText(request)
+	event.Text = parsedText
+	defer audit.Record(event)
+	r = r.WithContext(audit.NewContext(ctx, event))
+	ctx = r.Context()
+
+	// replies to confirmation and approval cards are sent either by their buttons or as text
+	decision, ok := command.ParseDecisionValue(request.Value)
+	if !ok {
+		decision, ok = command.ParseDecision(parsedText)
+	}
+	if ok {
+		switch decision.Action {
+		case command.ApproveAction, command.RejectAction:
+			handleApproval(clients, w, r, request, requester, decision)
+		default:
+			handleConfirmation(clients, w, r, request, requester, decision)
+		}
+		return
+	}
+
+	elevation, ok, err := command.ParseElevation(parsedText)
+	if ok {
+		handleElevation(w, r, request, requester, elevation, parsedText, err)
+		return
+	}
+
+	cmd, ok := parseAndValidate(w, r, request, requester, parsedText)
+	if !ok || !checkAccess(clients, w, r, request, requester, cmd, parsedText) {
+		return
+	}
+
+	if command.RequiresApproval(cmd) {
+		requestApproval(w, r, request, requester, cmd, parsedText)
+		return
+	}
+
+	if command.RequiresConfirmation(cmd) {
+		pending, err := command.RequestConfirmation(requester, cmd, parsedText)
+		if err != nil {
+			event.Fail(err)
+			middleware.LogWithContext(ctx).Errorf("failed to request confirmation: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(NewTextResponse("failed to request confirmation"))
+			return
+		}
+		event.ID = pending.ID
+		event.Decide(audit.DecisionConfirmationRequired, nil)
+		middleware.LogWithContext(ctx).Infof("Waiting for %s to confirm command %s: '%s'", request.From.Name, pending.ID, parsedText)
+		writeCardResponse(w, r, fmt.Sprintf("%s: confirm %s", request.From.Name, parsedText), pending)
+		return
+	}
+
+	executeCommand(clients, w, r, request, requester, cmd, parsedText, nil)
+}
+
+// handleConfirmation executes or discards the pending command that the requester confirmed or cancelled
+func handleConfirmation(clients k8s.Clients, w http.ResponseWriter, r *http.Request, request Request, requester command.Requester, decision command.Decision) {
+	ctx := r.Context()
+	event := audit.FromContext(ctx)
+	event.ID = decision.ID
+
+	pending, err := command.TakePendingCommand(requester, decision.ID)
+	if err != nil {
+		event.Fail(err)
+		middleware.LogWithContext(ctx).Errorf("failed to take pending command %s: %v", decision.ID, err)
+		writeResponse(w, NewTextResponse(fmt.Sprintf("%s - %v", request.From.Name, err)))
+		return
+	}
+
+	event.Command = pending.Command
+	if decision.Action != command.ConfirmAction {
+		event.Decide(audit.DecisionCancelled, nil)
+		middleware.LogWithContext(ctx).Infof("%s cancelled command %s: '%s'", request.From.Name, pending.ID, pending.Text)
+		writeResponse(w, NewTextResponse(fmt.Sprintf("%s - cancelled command: %s", request.From.Name, pending.Text)))
+		return
+	}
+
+	// the permissions may have changed since the command was requested
+	cmd, ok := parseAndValidate(w, r, request, requester, pending.Text)
+	if !ok || !checkAccess(clients, w, r, request, requester, cmd, pending.Text) {
+		return
+	}
+	// including the namespace becoming protected, in which case the confirmed command still needs approval
+	if command.RequiresApproval(cmd) {
+		requestApproval(w, r, request, requester, cmd, pending.Text)
+		return
+	}
+	event.Decide(audit.DecisionConfirmed, nil)
+	middleware.LogWithContext(ctx).Infof("%s confirmed command %s: '%s'", request.From.Name, pending.ID, pending.Text)
+	executeCommand(clients, w, r, request, requester, cmd, pending.Text, nil)
+}
+
+// requestApproval stores the command until another user approves it and responds with the approval card
+func requestApproval(w http.ResponseWriter, r *http.Request, request Request, requester command.Requester, cmd command.Command, text string) {
+	ctx := r.Context()
+	event := audit.FromContext(ctx)
+
+	approval, err := command.RequestApproval(requester, cmd, text)
+	if err != nil {
+		event.Fail(err)
+		middleware.LogWithContext(ctx).Errorf("failed to request approval: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(NewTextResponse("failed to request approval"))
+		return
+	}
+	event.ID = approval.ID
+	event.Decide(audit.DecisionApprovalRequired, nil)
+	middleware.LogWithContext(ctx).Infof("Waiting for approval of command %s from %s: '%s'", approval.ID, request.From.Name, text)
+	writeCardResponse(w, r, fmt.Sprintf("%s: approve %s", request.From.Name, text), approval)
+}
+
+// handleApproval executes the command waiting for approval as its requester once another user approves it, or discards it
+func handleApproval(clients k8s.Clients, w http.ResponseWriter, r *http.Request, request Request, approver command.Requester, decision command.Decision) {
+	ctx := r.Context()
+	event := audit.FromContext(ctx)
+	event.ID = decision.ID
+
+	if decision.Action == command.RejectAction {
+		approval, err := command.Reject(approver, decision.ID)
+		if err != nil {
+			event.Fail(err)
+			middleware.LogWithContext(ctx).Errorf("failed to reject command %s: %v", decision.ID, err)
+			writeResponse(w, NewTextResponse(fmt.Sprintf("%s - %v", request.From.Name, err)))
+			return
+		}
+		event.Command = approval.Command
+		event.Decide(audit.DecisionRejected, nil)
+		middleware.LogWithContext(ctx).Infof("%s rejected command %s requested by %s: '%s'", request.From.Name, approval.ID, approval.Requester.Name, approval.Text)
+		writeResponse(w, NewTextResponse(fmt.Sprintf("%s - rejected command requested by %s: %s", request.From.Name, approval.Requester.Name, approval.Text)))
+		return
+	}
+
+	// the access review runs before the approval is taken so that the command is still waiting for approval if it fails
+	approval, cmd, err := command.Approve(approver, decision.ID, func(requester command.Requester, cmd command.Command) error {
+		err := command.CheckAccess(clients, requester, cmd)
+		if _, denied := err.(*command.AccessDeniedError); err != nil && !denied {
+			return errors.New(fmt.Sprintf("unable to check whether %s is allowed to execute command %s, it's still waiting for approval: %v", requester.Name, decision.ID, err))
+		}
+		return err
+	})
+	if err != nil {
+		middleware.LogWithContext(ctx).Errorf("failed to approve command %s: %v", decision.ID, err)
+		msg := fmt.Sprintf("%s - %v", request.From.Name, err)
+		event.Fail(err)
+		if deniedErr, ok := err.(*command.AccessDeniedError); ok {
+			msg = fmt.Sprintf("%s - command %s can't be executed as the user that requested it: %v", request.From.Name, decision.ID, deniedErr)
+			event.Decide(audit.DecisionDenied, deniedErr)
+		}
+		writeResponse(w, NewTextResponse(msg))
+		return
+	}
+	event.Approver = request.From.Name
+	event.Decide(audit.DecisionApproved, nil)
+	middleware.LogWithContext(ctx).Infof("%s approved command %s requested by %s: '%s'", request.From.Name, approval.ID, approval.Requester.Name, approval.Text)
+	if approval.Elevation != nil {
+		event.Command = approval.Elevation
+		writeCardResponse(w, r, fmt.Sprintf("%s: %s", approval.Requester.Name, approval.Text), &command.ApprovedCommand{Approval: approval})
+		return
+	}
+	event.Command = cmd
+	executeCommand(clients, w, r, request, approval.Requester, cmd, approval.Text, approval)
+}
+
+// handleElevation grants the requested role to the requester for a limited time, or asks one of the role's approvers to approve it
+func handleElevation(w http.ResponseWriter, r *http.Request, request Request, requester command.Requester, elevation command.ElevationRequest, text string, err error) {
+	ctx := r.Context()
+	event := audit.FromContext(ctx)
+
+	if err != nil {
+		event.Fail(err)
+		middleware.LogWithContext(ctx).Errorf("failed to parse elevation: '%s', got %v", text, err)
+		writeResponse(w, NewTextResponse(fmt.Sprintf("%s - failed to parse command '%s': %v", request.From.Name, text, err)))
+		return
+	}
+
+	event.Command = elevation
+	result, err := command.Elevate(requester, elevation, text)
+	if err != nil {
+		event.Decide(audit.DecisionDenied, err)
+		middleware.LogWithContext(ctx).Errorf("failed to elevate %s to role %s: %v", request.From.Name, elevation.Role, err)
+		writeResponse(w, NewTextResponse(fmt.Sprintf("%s - %v", request.From.Name, err)))
+		return
+	}
+
+	summary := fmt.Sprintf("%s: %s", request.From.Name, text)
+	event.Decide(audit.DecisionGranted, nil)
+	if granted, ok := result.(*command.Elevation); ok {
+		event.ID = granted.ID
+	}
+	if approval, ok := result.(*command.ApprovalRequest); ok {
+		event.ID = approval.ID
+		event.Decide(audit.DecisionApprovalRequired, nil)
+		middleware.LogWithContext(ctx).Infof("Waiting for approval of elevation %s from %s: '%s'", approval.ID, request.From.Name, text)
+		summary = fmt.Sprintf("%s: approve %s", request.From.Name, text)
+	}
+	writeCardResponse(w, r, summary, result)
+}
+
+// writeCardResponse renders the result as an adaptive card and writes it in the response
+func writeCardResponse(w http.ResponseWriter, r *http.Request, summary string, result interface{}) {
+	card, err := command.PrepareResponse(result)
+	if err != nil {
+		audit.FromContext(r.Context()).Fail(err)
+		middleware.LogWithContext(r.Context()).Errorf("failed to prepare response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(NewTextResponse("failed to prepare response"))
+		return
+	}
+	writeResponse(w, NewCardResponse(summary, card))
+}
+
+// parseAndValidate parses the command and checks that the requester is permitted to execute it.
+// The reason is written to the response when the command can't be executed.
+func parseAndValidate(w http.ResponseWriter, r *http.Request, request Request, requester command.Requester, text string) (command.Command, bool) {
+	event := audit.FromContext(r.Context())
+	cmd, err := command.ParseAndValidateCommandFromString(requester, text)
+	if err != nil {
+		middleware.LogWithContext(r.Context()).Errorf("failed to parse and validate command: '%s', got %v", text, err)
+		msg := fmt.Sprintf("%s - that command is not available. Please specify a valid command.", request.From.Name)
+		event.Decide(audit.DecisionDenied, err)
+		if parseErr, ok := err.(*command.ParseError); ok {
+			msg = fmt.Sprintf("%s - failed to parse command '%s': %v", request.From.Name, text, parseErr)
+			event.Fail(parseErr)
+		}
+		writeResponse(w, NewTextResponse(msg))
+		return command.Command{}, false
+	}
+	event.Command = cmd
+	return cmd, true
+}
+
+// checkAccess checks with the API server that the requester is allowed to execute the command.
+// The reason is written to the response when the command can't be executed.
+func checkAccess(clients k8s.Clients, w http.ResponseWriter, r *http.Request, request Request, requester command.Requester, cmd command.Command, text string) bool {
+	err := command.CheckAccess(clients, requester, cmd)
+	if err != nil {
+		middleware.LogWithContext(r.Context()).Errorf("access review failed for command: '%s', got %v", text, err)
+		msg := fmt.Sprintf("%s - unable to check whether you are allowed to execute command: %s", request.From.Name, text)
+		if deniedErr, ok := err.(*command.AccessDeniedError); ok {
+			msg = fmt.Sprintf("%s - %v", request.From.Name, deniedErr)
+			audit.FromContext(r.Context()).Decide(audit.DecisionDenied, deniedErr)
+		} else {
+			audit.FromContext(r.Context()).Fail(err)
+		}
+		writeResponse(w, NewTextResponse(msg))
+		return false
+	}
+	return true
+}
+
+// executeCommand executes the validated command as the requester and responds with the result rendered as an adaptive card
+// approval is the approval request when the command was approved by another user, which is shown with the result
+func executeCommand(clients k8s.Clients, w http.ResponseWriter, r *http.Request, request Request, requester command.Requester, cmd command.Command, text string, approval *command.ApprovalRequest) {
+	ctx := r.Context()
+	event := audit.FromContext(ctx)
+	if event.Decision == "" {
+		event.Decide(audit.DecisionAllowed, nil)
+	}
+
+	requesterClients, err := command.ClientsFor(clients, requester)
+	if err != nil {
+		event.Fail(err)
+		middleware.LogWithContext(ctx).Errorf("failed to get clients for %s: %v", request.From.Name, err)
+		msg := fmt.Sprintf("%s - unable to execute commands as your kubernetes user: %v", request.From.Name, err)
+		writeResponse(w, NewTextResponse(msg))
+		return
+	}
+
+	result, err := command.ExecuteCommand(requesterClients, cmd)
+	if err != nil {
+		middleware.LogWithContext(ctx).Errorf("failed to execute command: '%s', got %v", text, err)
+		msg := fmt.Sprintf("%s - failed to execute command: %s", request.From.Name, text)
+		event.Fail(err)
+		if deniedErr, ok := err.(*command.AccessDeniedError); ok {
+			msg = fmt.Sprintf("%s - %v", request.From.Name, deniedErr)
+			event.Decide(audit.DecisionDenied, deniedErr)
+		}
+		writeResponse(w, NewTextResponse(msg))
+		return
+	}
+
+	if approval != nil {
+		result = &command.ApprovedCommand{Approval: approval, Result: result}
+	}
+	// teams-kontrol records the event itself as the requester may not be allowed to
+	err = command.RecordAction(clients, requester, cmd, result)
+	if err != nil {
+		middleware.LogWithContext(ctx).Warnf("failed to record action for command: '%s', got %v", text, err)
+	}
+	card, err := command.PrepareResponse(result)
+	if err != nil {
+		event.Fail(err)
+		middleware.LogWithContext(ctx).Errorf("failed to prepare response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(NewTextResponse("failed to prepare response"))
+		return
+	}
+
+	var teamsResponse *Response
+	if card == nil { // nothing to render, i.e. delete
+		teamsResponse = NewTextResponse(fmt.Sprintf("%s - successfully executed command: %s", request.From.Name, text))
+	} else {
+		teamsResponse = NewCardResponse(fmt.Sprintf("%s: %s", request.From.Name, text), card)
 	}
 
 	middleware.LogWithContext(ctx).Info("Finished processing request")
 
+	writeResponse(w, teamsResponse)
+}
+
+// writeResponse encodes the teams response and writes it with a 200 status code.
+// teams will only display the message to the user if the status code is 200
+func writeResponse(w http.ResponseWriter, teamsResponse *Response) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(teamsResponse)
 }
@@ -177,6 +522,24 @@ func AuthHandler(next http.Handler) http.Handler {
 		}
 
 		if verifiedMAC { // user authenticated
+			// the signature doesn't expire so a captured request could otherwise be sent again
+			var activity struct {
+				ID        string    `json:"id"`
+				Timestamp time.Time `json:"timestamp"`
+			}
+			err = json.Unmarshal(body, &activity)
+			if err != nil {
+				middleware.LogWithContext(ctx).Errorf("failed to parse activity from client: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			err = replays.check(activity.ID, activity.Timestamp)
+			if err != nil {
+				middleware.LogWithContext(ctx).Warnf("Rejected request to protected endpoint: %v", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
 			// set the request body for the next request as we've already read it
 			r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 			next.ServeHTTP(w, r)
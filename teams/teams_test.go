@@ -2,13 +2,32 @@ package teams
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"github.com/daniel-cole/teams-kontrol/audit"
+	"github.com/daniel-cole/teams-kontrol/command"
+	"github.com/daniel-cole/teams-kontrol/k8s"
 	"github.com/daniel-cole/teams-kontrol/util"
+	"io/ioutil"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 var testRequest = `{
@@ -88,6 +107,14 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Failed to set %s", KontrolSharedSecretEnvKey)
 	}
 	Init()
+
+	teamsKontrolPermissionFile := "testdata/permissions.yml"
+	err = util.AttemptSetEnv(command.KontrolPermissionFileEnvKey, teamsKontrolPermissionFile)
+	if err != nil {
+		log.Fatalf("Failed to set %s", command.KontrolPermissionFileEnvKey)
+	}
+	command.Init()
+
 	os.Exit(m.Run())
 }
 
@@ -97,14 +124,66 @@ func TestParseTeamsRequestText(t *testing.T) {
 	if err != nil {
 		t.Fatal("Failed to unmarshal JSON to request")
 	}
-	text := request.Text
-	parsedText := parseTeamsRequestText(text)
+	parsedText := parseTeamsRequestText(request)
 	expectedParsedText := "debug last time"
 	if parsedText != expectedParsedText {
 		t.Fatalf("Parsed text does not match expected text, got %s, expected %s", parsedText, expectedParsedText)
 	}
 }
 
+// payloads in testdata/mentions are captured from teams with identifiers replaced
+func TestParseTeamsRequestTextPayloads(t *testing.T) {
+	tests := []struct {
+		payload  string
+		expected string
+	}{
+		{"trailing_newline.json", "get pods default"},
+		{"no_trailing_newline.json", "get pods default"},
+		{"mid_sentence.json", "get pods default"},
+		{"html_entities.json", "get pods default"},
+		{"attachment_only.json", "get pods default"},
+		{"multiple_mentions.json", "get pods default for Jane Doe"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.payload, func(t *testing.T) {
+			payload, err := ioutil.ReadFile(filepath.Join("testdata", "mentions", test.payload))
+			if err != nil {
+				t.Fatalf("failed to read payload: %v", err)
+			}
+
+			var request Request
+			err = json.Unmarshal(payload, &request)
+			if err != nil {
+				t.Fatalf("failed to unmarshal payload: %v", err)
+			}
+
+			parsedText := parseTeamsRequestText(request)
+			if parsedText != test.expected {
+				t.Fatalf("parsed text does not match expected text, got '%s', expected '%s'", parsedText, test.expected)
+			}
+		})
+	}
+}
+
+func TestRequestRawTextAttachmentOnly(t *testing.T) {
+	payload, err := ioutil.ReadFile(filepath.Join("testdata", "mentions", "attachment_only.json"))
+	if err != nil {
+		t.Fatalf("failed to read payload: %v", err)
+	}
+	var request Request
+	err = json.Unmarshal(payload, &request)
+	if err != nil {
+		t.Fatalf("failed to unmarshal payload: %v", err)
+	}
+
+	// the text doesn't include the mention so the html attachment is what was sent
+	rawText := requestRawText(request)
+	if rawText != request.Attachments[0].Content {
+		t.Errorf("expected the raw text to be the html attachment, instead got '%s'", rawText)
+	}
+}
+
 func TestHandleMessage(t *testing.T) {
 	var request Request
 	err := json.Unmarshal([]byte(testRequest), &request)
@@ -125,7 +204,7 @@ func TestHandleMessage(t *testing.T) {
 	req.Header.Add("Content-type", "Application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(MessageHandler)
+	handler := messageHandlerWithClient(fake.NewSimpleClientset())
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusOK {
@@ -140,6 +219,564 @@ func TestHandleMessage(t *testing.T) {
 
 }
 
+func TestHandleMessageGetPods(t *testing.T) {
+	var request Request
+	err := json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> get pods nginx\n"
+
+	jsonRequest, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal("Failed to marshal JSON request")
+	}
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx-ingress-controller-a12fb",
+			Namespace: "nginx",
+		},
+	})
+
+	req, err := http.NewRequest("POST", "/teams", bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-type", "Application/json")
+
+	rr := httptest.NewRecorder()
+	handler := messageHandlerWithClient(client)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v expected %v", status, http.StatusOK)
+	}
+
+	var response Response
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Attachments) != 1 {
+		t.Fatalf("expected response to contain 1 attachment, instead got %d", len(response.Attachments))
+	}
+
+	if response.Attachments[0].ContentType != adaptiveCardContentType {
+		t.Errorf("expected attachment content type to be %s, instead got %s", adaptiveCardContentType, response.Attachments[0].ContentType)
+	}
+
+	var card map[string]interface{}
+	err = json.Unmarshal(response.Attachments[0].Content, &card)
+	if err != nil {
+		t.Fatalf("expected attachment content to be a json object: %v", err)
+	}
+	if card["type"] != "AdaptiveCard" {
+		t.Errorf("expected attachment content to be an AdaptiveCard, instead got %v", card["type"])
+	}
+
+	expectedSummary := "Daniel Cole: get pods nginx"
+	if response.Summary != expectedSummary {
+		t.Errorf("expected summary to be %s, instead got %s", expectedSummary, response.Summary)
+	}
+}
+
+func TestHandleMessageParseError(t *testing.T) {
+	var request Request
+	err := json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> get pods \"default\n"
+
+	jsonRequest, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal("Failed to marshal JSON request")
+	}
+
+	req, err := http.NewRequest("POST", "/teams", bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-type", "Application/json")
+
+	rr := httptest.NewRecorder()
+	handler := messageHandlerWithClient(fake.NewSimpleClientset())
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v expected %v", status, http.StatusOK)
+	}
+
+	expectedResponse := `{"type":"message","text":"Daniel Cole - failed to parse command 'get pods \"default': unterminated \" quote at position 10"}` + "\n"
+	response := rr.Body.String()
+	if response != expectedResponse {
+		t.Errorf("handler returned unexpected body: got %v expected : %v", response, expectedResponse)
+	}
+}
+
+func TestHandleMessageAccessDenied(t *testing.T) {
+	err := command.UpdatePermissions([]byte("verbs: [\"delete\"]\nresources: [\"pods\"]\nnamespaces: [\"default\"]\naccessReview: true\n"), "test")
+	if err != nil {
+		t.Fatalf("failed to update permissions: %v", err)
+	}
+	defer func() {
+		original, err := ioutil.ReadFile("testdata/permissions.yml")
+		if err == nil {
+			err = command.UpdatePermissions(original, "testdata/permissions.yml")
+		}
+		if err != nil {
+			t.Fatalf("failed to restore permissions: %v", err)
+		}
+	}()
+
+	var request Request
+	err = json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> delete pods default nginx\n"
+
+	jsonRequest, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal("Failed to marshal JSON request")
+	}
+
+	req, err := http.NewRequest("POST", "/teams", bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-type", "Application/json")
+
+	// the fake client doesn't fill in the status of access reviews so every command is denied
+	rr := httptest.NewRecorder()
+	handler := messageHandlerWithClient(fake.NewSimpleClientset())
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v expected %v", status, http.StatusOK)
+	}
+
+	expectedResponse := `{"type":"message","text":"Daniel Cole - you are not allowed to delete pods/nginx in namespace default"}` + "\n"
+	response := rr.Body.String()
+	if response != expectedResponse {
+		t.Errorf("handler returned unexpected body: got %v expected : %v", response, expectedResponse)
+	}
+}
+
+// sendTestRequest sends the request to the message handler with the given client and returns the teams response
+func sendTestRequest(t *testing.T, client kubernetes.Interface, request Request) Response {
+	t.Helper()
+	jsonRequest, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal("Failed to marshal JSON request")
+	}
+	req, err := http.NewRequest("POST", "/teams", bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-type", "Application/json")
+
+	rr := httptest.NewRecorder()
+	messageHandlerWithClient(client).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v expected %v", status, http.StatusOK)
+	}
+
+	var response Response
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	return response
+}
+
+// confirmationData returns the data sent by the confirm button of the confirmation card in the response
+func confirmationData(t *testing.T, response Response) map[string]interface{} {
+	t.Helper()
+	if len(response.Attachments) != 1 {
+		t.Fatalf("expected response to contain a confirmation card, instead got %v", response)
+	}
+	var card struct {
+		Actions []struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"actions"`
+	}
+	err := json.Unmarshal(response.Attachments[0].Content, &card)
+	if err != nil || len(card.Actions) != 2 {
+		t.Fatalf("expected confirmation card to have confirm and cancel actions: %v", err)
+	}
+	return card.Actions[0].Data
+}
+
+func TestHandleMessageConfirmDelete(t *testing.T) {
+	var request Request
+	err := json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> delete pods nginx nginx-ingress-controller-a12fb\n"
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx-ingress-controller-a12fb",
+			Namespace: "nginx",
+		},
+	})
+
+	response := sendTestRequest(t, client, request)
+	data := confirmationData(t, response)
+	_, err = client.CoreV1().Pods("nginx").Get("nginx-ingress-controller-a12fb", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected pod to exist until the delete is confirmed: %v", err)
+	}
+
+	// another user can't confirm the command
+	other := request
+	other.Text = ""
+	other.Value = data
+	other.From.AadObjectID = "other"
+	other.From.Name = "Someone Else"
+	response = sendTestRequest(t, client, other)
+	expectedText := "Someone Else - only Daniel Cole can confirm or cancel command " + data[command.DecisionIDKey].(string)
+	if response.Text != expectedText {
+		t.Errorf("expected response text %s, instead got %s", expectedText, response.Text)
+	}
+
+	confirm := request
+	confirm.Text = ""
+	confirm.Value = data
+	response = sendTestRequest(t, client, confirm)
+	expectedText = "Daniel Cole - successfully executed command: delete pods nginx nginx-ingress-controller-a12fb"
+	if response.Text != expectedText {
+		t.Errorf("expected response text %s, instead got %s", expectedText, response.Text)
+	}
+	_, err = client.CoreV1().Pods("nginx").Get("nginx-ingress-controller-a12fb", metav1.GetOptions{})
+	if err == nil {
+		t.Fatalf("expected pod to be deleted once the delete is confirmed")
+	}
+}
+
+func TestHandleMessageConfirmDeleteInProtectedNamespace(t *testing.T) {
+	original, err := ioutil.ReadFile("testdata/permissions.yml")
+	if err != nil {
+		t.Fatalf("failed to read permissions: %v", err)
+	}
+	defer func() {
+		err := command.UpdatePermissions(original, "testdata/permissions.yml")
+		if err != nil {
+			t.Fatalf("failed to restore permissions: %v", err)
+		}
+	}()
+
+	var request Request
+	err = json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> delete pods nginx nginx-ingress-controller-a12fb\n"
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx-ingress-controller-a12fb",
+			Namespace: "nginx",
+		},
+	})
+	data := confirmationData(t, sendTestRequest(t, client, request))
+
+	// the namespace becomes protected while the command is waiting to be confirmed
+	protected := append(append([]byte{}, original...), []byte("approval:\n  namespaces: [\"nginx\"]\n")...)
+	err = command.UpdatePermissions(protected, "test")
+	if err != nil {
+		t.Fatalf("failed to update permissions: %v", err)
+	}
+
+	confirm := request
+	confirm.Text = ""
+	confirm.Value = data
+	response := sendTestRequest(t, client, confirm)
+	expectedSummary := "Daniel Cole: approve delete pods nginx nginx-ingress-controller-a12fb"
+	if response.Summary != expectedSummary {
+		t.Errorf("expected summary to be %s, instead got %s", expectedSummary, response.Summary)
+	}
+	_, err = client.CoreV1().Pods("nginx").Get("nginx-ingress-controller-a12fb", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected pod to exist until the delete is approved: %v", err)
+	}
+}
+
+func TestHandleMessageCancelDelete(t *testing.T) {
+	var request Request
+	err := json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> delete pods nginx nginx-ingress-controller-a12fb\n"
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx-ingress-controller-a12fb",
+			Namespace: "nginx",
+		},
+	})
+
+	data := confirmationData(t, sendTestRequest(t, client, request))
+	id := data[command.DecisionIDKey].(string)
+
+	cancel := request
+	cancel.Text = "<at>teams-kontrol</at> cancel " + id + "\n"
+	response := sendTestRequest(t, client, cancel)
+	expectedText := "Daniel Cole - cancelled command: delete pods nginx nginx-ingress-controller-a12fb"
+	if response.Text != expectedText {
+		t.Errorf("expected response text %s, instead got %s", expectedText, response.Text)
+	}
+
+	confirm := request
+	confirm.Text = "<at>teams-kontrol</at> confirm " + id + "\n"
+	response = sendTestRequest(t, client, confirm)
+	if !strings.Contains(response.Text, "there's no pending command") {
+		t.Errorf("expected a cancelled command to be unable to be confirmed, instead got %s", response.Text)
+	}
+	_, err = client.CoreV1().Pods("nginx").Get("nginx-ingress-controller-a12fb", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected pod to exist after the delete is cancelled: %v", err)
+	}
+}
+
+func TestHandleMessageApproveDelete(t *testing.T) {
+	err := command.UpdatePermissions([]byte("verbs: [\"delete\"]\nresources: [\"pods\"]\nnamespaces: [\"prod-*\"]\napproval:\n  namespaces: [\"prod-*\"]\n"), "test")
+	if err != nil {
+		t.Fatalf("failed to update permissions: %v", err)
+	}
+	defer func() {
+		original, err := ioutil.ReadFile("testdata/permissions.yml")
+		if err == nil {
+			err = command.UpdatePermissions(original, "testdata/permissions.yml")
+		}
+		if err != nil {
+			t.Fatalf("failed to restore permissions: %v", err)
+		}
+	}()
+
+	var request Request
+	err = json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> delete pods prod-payments payments-1\n"
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "payments-1",
+			Namespace: "prod-payments",
+		},
+	})
+
+	response := sendTestRequest(t, client, request)
+	expectedSummary := "Daniel Cole: approve delete pods prod-payments payments-1"
+	if response.Summary != expectedSummary {
+		t.Fatalf("expected summary to be %s, instead got %s", expectedSummary, response.Summary)
+	}
+	data := confirmationData(t, response)
+
+	// the requester can't approve their own command
+	approve := request
+	approve.Text = ""
+	approve.Value = data
+	response = sendTestRequest(t, client, approve)
+	if !strings.Contains(response.Text, "must be approved by someone other than Daniel Cole") {
+		t.Errorf("expected the requester to be unable to approve their own command, instead got %s", response.Text)
+	}
+
+	approve.From.AadObjectID = "other"
+	approve.From.Name = "Someone Else"
+	response = sendTestRequest(t, client, approve)
+	if len(response.Attachments) != 1 {
+		t.Fatalf("expected the approved command to respond with a card, instead got %v", response)
+	}
+	content := string(response.Attachments[0].Content)
+	if !strings.Contains(content, `"value":"Daniel Cole"`) || !strings.Contains(content, `"value":"Someone Else"`) {
+		t.Errorf("expected the card to show the requester and approver, instead got %s", content)
+	}
+	_, err = client.CoreV1().Pods("prod-payments").Get("payments-1", metav1.GetOptions{})
+	if err == nil {
+		t.Fatalf("expected pod to be deleted once the delete is approved")
+	}
+}
+
+func TestHandleMessageApproveAccessReviewFailure(t *testing.T) {
+	err := command.UpdatePermissions([]byte("verbs: [\"delete\"]\nresources: [\"pods\"]\nnamespaces: [\"prod-*\"]\naccessReview: true\napproval:\n  namespaces: [\"prod-*\"]\n"), "test")
+	if err != nil {
+		t.Fatalf("failed to update permissions: %v", err)
+	}
+	defer func() {
+		original, err := ioutil.ReadFile("testdata/permissions.yml")
+		if err == nil {
+			err = command.UpdatePermissions(original, "testdata/permissions.yml")
+		}
+		if err != nil {
+			t.Fatalf("failed to restore permissions: %v", err)
+		}
+	}()
+
+	var request Request
+	err = json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.Text = "<at>teams-kontrol</at> delete pods prod-payments payments-1\n"
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "payments-1",
+			Namespace: "prod-payments",
+		},
+	})
+	reviewFails := false
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if reviewFails {
+			return true, &authorizationv1.SelfSubjectAccessReview{}, errors.New("api server unavailable")
+		}
+		return true, &authorizationv1.SelfSubjectAccessReview{Status: authorizationv1.SubjectAccessReviewStatus{Allowed: true}}, nil
+	})
+
+	data := confirmationData(t, sendTestRequest(t, client, request))
+
+	approve := request
+	approve.Text = ""
+	approve.Value = data
+	approve.From.AadObjectID = "other"
+	approve.From.Name = "Someone Else"
+	reviewFails = true
+	response := sendTestRequest(t, client, approve)
+	if !strings.Contains(response.Text, "still waiting for approval: failed to review access: api server unavailable") {
+		t.Errorf("expected the approver to be told that the access review failed, instead got %s", response.Text)
+	}
+	_, err = client.CoreV1().Pods("prod-payments").Get("payments-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected pod to exist when the access review fails: %v", err)
+	}
+
+	// the command is still waiting for approval so it can be approved once the access review succeeds
+	reviewFails = false
+	response = sendTestRequest(t, client, approve)
+	if len(response.Attachments) != 1 {
+		t.Fatalf("expected the approved command to respond with a card, instead got %v", response)
+	}
+	_, err = client.CoreV1().Pods("prod-payments").Get("payments-1", metav1.GetOptions{})
+	if err == nil {
+		t.Fatalf("expected pod to be deleted once the delete is approved")
+	}
+}
+
+func TestHandleMessageElevate(t *testing.T) {
+	err := command.UpdatePermissions([]byte(`
+verbs: ["get"]
+resources: ["pods"]
+namespaces: ["default"]
+elevation:
+  roles:
+    - name: "incident"
+      maxDuration: "1h"
+      subjects: [{name: "Daniel Cole"}]
+      verbs: ["scale"]
+      resources: ["deployments"]
+      namespaces: ["default"]
+`), "test")
+	if err != nil {
+		t.Fatalf("failed to update permissions: %v", err)
+	}
+	defer func() {
+		original, err := ioutil.ReadFile("testdata/permissions.yml")
+		if err == nil {
+			err = command.UpdatePermissions(original, "testdata/permissions.yml")
+		}
+		if err != nil {
+			t.Fatalf("failed to restore permissions: %v", err)
+		}
+	}()
+
+	var request Request
+	err = json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	requester := command.Requester{AADObjectID: request.From.AadObjectID, Name: request.From.Name}
+	_, err = command.ParseAndValidateCommandFromString(requester, "scale default nginx --replicas=3")
+	if err == nil {
+		t.Fatal("expected scale to be denied before elevating")
+	}
+
+	request.Text = "<at>teams-kontrol</at> elevate incident 2h database is down\n"
+	response := sendTestRequest(t, fake.NewSimpleClientset(), request)
+	if !strings.Contains(response.Text, "role incident can be granted for at most 1h") {
+		t.Errorf("expected elevation longer than the role's max duration to be denied, instead got %s", response.Text)
+	}
+
+	request.Text = "<at>teams-kontrol</at> elevate incident 30m database is down\n"
+	response = sendTestRequest(t, fake.NewSimpleClientset(), request)
+	if len(response.Attachments) != 1 || !strings.Contains(string(response.Attachments[0].Content), "Elevated Access Granted") {
+		t.Fatalf("expected the elevation to respond with a card, instead got %v", response)
+	}
+	_, err = command.ParseAndValidateCommandFromString(requester, "scale default nginx --replicas=3")
+	if err != nil {
+		t.Errorf("expected scale to be permitted after elevating: %v", err)
+	}
+}
+
+// recordingSink keeps the audit events written to it
+type recordingSink struct {
+	events []*audit.Event
+}
+
+func (s *recordingSink) Write(event *audit.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestHandleMessageAudit(t *testing.T) {
+	sink := &recordingSink{}
+	audit.SetSinks(sink)
+	defer audit.SetSinks()
+
+	var request Request
+	err := json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+
+	tests := []struct {
+		text     string
+		decision string
+		result   string
+	}{
+		{"get pods nginx", audit.DecisionAllowed, audit.ResultSuccess},
+		{"delete pods kube-system coredns", audit.DecisionDenied, audit.ResultFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			sink.events = nil
+			request.Text = "<at>teams-kontrol</at> " + test.text + "\n"
+			sendTestRequest(t, fake.NewSimpleClientset(), request)
+
+			if len(sink.events) != 1 {
+				t.Fatalf("expected 1 audit event, instead got %d", len(sink.events))
+			}
+			event := sink.events[0]
+			if event.User != "Daniel Cole" || event.AADObjectID != request.From.AadObjectID || event.Text != test.text {
+				t.Errorf("expected the requester and text to be recorded, instead got %+v", event)
+			}
+			if event.RawText != request.Text {
+				t.Errorf("expected the raw text %q to be recorded, instead got %q", request.Text, event.RawText)
+			}
+			if event.Decision != test.decision || event.Result != test.result {
+				t.Errorf("expected decision %s and result %s, instead got %s and %s", test.decision, test.result, event.Decision, event.Result)
+			}
+		})
+	}
+}
+
 func TestTeamsAuth(t *testing.T) {
 
 	var request Request
@@ -147,6 +784,8 @@ func TestTeamsAuth(t *testing.T) {
 	if err != nil {
 		t.Fatal("Failed to unmarshal JSON to request")
 	}
+	request.ID = "auth"
+	request.Timestamp = time.Now()
 
 	jsonRequest, err := json.Marshal(request)
 	if err != nil {
@@ -159,10 +798,10 @@ func TestTeamsAuth(t *testing.T) {
 		t.Fatal(err)
 	}
 	req.Header.Add("Content-type", "Application/json")
-	req.Header.Add("Authorization", "HMAC AUcyAKsiB2yCYuFhsz6O9qQ0gY+hQFL3IDxbTJhMWFY=")
+	req.Header.Add("Authorization", "HMAC "+computeMAC(t, secret, jsonRequest))
 
 	rr := httptest.NewRecorder()
-	handler := AuthHandler(http.HandlerFunc(MessageHandler))
+	handler := AuthHandler(messageHandlerWithClient(fake.NewSimpleClientset()))
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusOK {
@@ -177,6 +816,97 @@ func TestTeamsAuth(t *testing.T) {
 
 }
 
+// sendSignedRequest signs the request with the shared secret and sends it through the auth handler
+func sendSignedRequest(t *testing.T, request Request) int {
+	t.Helper()
+	jsonRequest, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal("Failed to marshal JSON request")
+	}
+	req, err := http.NewRequest("POST", "/teams", bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-type", "Application/json")
+	req.Header.Add("Authorization", "HMAC "+computeMAC(t, secret, jsonRequest))
+
+	rr := httptest.NewRecorder()
+	AuthHandler(messageHandlerWithClient(fake.NewSimpleClientset())).ServeHTTP(rr, req)
+	return rr.Code
+}
+
+// rejectedCount returns the number of requests rejected for the reason
+func rejectedCount(reason string) int64 {
+	if count, ok := rejectedRequests.Get(reason).(*expvar.Int); ok {
+		return count.Value()
+	}
+	return 0
+}
+
+func TestTeamsAuthReplay(t *testing.T) {
+	var request Request
+	err := json.Unmarshal([]byte(testRequest), &request)
+	if err != nil {
+		t.Fatal("Failed to unmarshal JSON to request")
+	}
+	request.ID = "replay"
+	request.Timestamp = time.Now()
+
+	if status := sendSignedRequest(t, request); status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v expected %v", status, http.StatusOK)
+	}
+	replayed := rejectedCount("replayed")
+	if status := sendSignedRequest(t, request); status != http.StatusUnauthorized {
+		t.Errorf("expected the replayed request to be rejected, got status %v", status)
+	}
+	if rejectedCount("replayed") != replayed+1 {
+		t.Error("expected the replayed request to be counted")
+	}
+
+	request.ID = "expired"
+	request.Timestamp = time.Now().Add(-time.Hour)
+	if status := sendSignedRequest(t, request); status != http.StatusUnauthorized {
+		t.Errorf("expected the request outside of the window to be rejected, got status %v", status)
+	}
+
+	request.ID = "future"
+	request.Timestamp = time.Now().Add(time.Hour)
+	if status := sendSignedRequest(t, request); status != http.StatusUnauthorized {
+		t.Errorf("expected the request ahead of the window to be rejected, got status %v", status)
+	}
+}
+
+func TestReplayGuardBounded(t *testing.T) {
+	guard := newReplayGuard(time.Minute, 2)
+	current := time.Now()
+	for _, id := range []string{"1", "2", "3"} {
+		err := guard.check(id, current)
+		if err != nil {
+			t.Fatalf("expected activity %s to be accepted: %v", id, err)
+		}
+	}
+	if len(guard.seen) != 2 {
+		t.Errorf("expected the cache to be bounded to 2 activities, got %d", len(guard.seen))
+	}
+	if err := guard.check("3", current); err == nil {
+		t.Error("expected the most recent activity to be rejected as a replay")
+	}
+
+	// activities are forgotten once they'd be rejected by the window anyway
+	defer func() {
+		now = time.Now
+	}()
+	now = func() time.Time {
+		return current.Add(3 * time.Minute)
+	}
+	if err := guard.check("4", now()); err != nil {
+		t.Fatalf("expected activity 4 to be accepted: %v", err)
+	}
+	if len(guard.seen) != 1 {
+		t.Errorf("expected expired activities to be forgotten, got %d", len(guard.seen))
+	}
+}
+
 func TestVerifyMac(t *testing.T) {
 	secret := "c2VjcmV0Cg==" // secret is "secret"
 	expectedMAC := "hXdVxuUH16fgQm1bM9Y+EcBfGmTkcoVdmT9Om0HlLmA="
@@ -190,3 +920,20 @@ func TestVerifyMac(t *testing.T) {
 		t.Fatalf("expected MAC to be verified")
 	}
 }
+
+func messageHandlerWithClient(client kubernetes.Interface) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		MessageHandler(k8s.Clients{Kubernetes: client}, w, r)
+	})
+}
+
+// computeMAC returns the base64 encoded HMAC of the payload as teams would compute it with the base64 encoded secret
+func computeMAC(t *testing.T, secret string, payload []byte) string {
+	secretBytes, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("failed to decode secret: %v", err)
+	}
+	h := hmac.New(sha256.New, secretBytes)
+	h.Write(payload)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}